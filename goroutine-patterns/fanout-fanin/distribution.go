@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+)
+
+// Distribution decides which outputs of fanOut receive an item
+type Distribution int
+
+const (
+	// Compete lets every output take the next item from the source, the first ready wins
+	Compete Distribution = iota
+	// Broadcast sends every item to every output, to tee a source to several sinks
+	Broadcast
+	// RoundRobin sends the items to the outputs in turn
+	RoundRobin
+	// KeyHash sends the items of the same key to the same output, see WithKeyHash
+	KeyHash
+)
+
+// String returns the name of the distribution
+func (d Distribution) String() string {
+	switch d {
+	case Compete:
+		return "compete"
+	case Broadcast:
+		return "broadcast"
+	case RoundRobin:
+		return "round-robin"
+	case KeyHash:
+		return "key-hash"
+	default:
+		return "unknown"
+	}
+}
+
+// SlowConsumerPolicy decides what happens to an item for an output that is not ready for it
+type SlowConsumerPolicy int
+
+const (
+	// SlowBlock waits for the output, slowing the distribution down
+	SlowBlock SlowConsumerPolicy = iota
+	// SlowDrop drops the item when the buffer of the output is full. On an unbuffered
+	// output, any item arriving while its worker is busy is dropped: nearly all of them.
+	SlowDrop
+)
+
+// String returns the name of the policy
+func (s SlowConsumerPolicy) String() string {
+	switch s {
+	case SlowBlock:
+		return "block"
+	case SlowDrop:
+		return "drop"
+	default:
+		return "unknown"
+	}
+}
+
+// FanOutOption configures a call to fanOut
+type FanOutOption func(*fanOutOptions)
+
+// fanOutOptions holds the settings of a call to fanOut
+type fanOutOptions struct {
+	distribution Distribution
+	key          any // func(T) string, checked by fanOut
+	buffers      []int
+	slow         SlowConsumerPolicy
+}
+
+// WithDistribution sets how the items are distributed, Compete by default
+func WithDistribution(distribution Distribution) FanOutOption {
+	return func(o *fanOutOptions) {
+		o.distribution = distribution
+	}
+}
+
+// WithKeyHash distributes the items by the hash of their key, so that the items
+// of the same key always go to the same output, in order
+func WithKeyHash[T any](key func(T) string) FanOutOption {
+	return func(o *fanOutOptions) {
+		o.distribution = KeyHash
+		o.key = key
+	}
+}
+
+// WithBuffers sets the buffer size of each output, in order. A single size applies
+// to every output, and the outputs without a size are unbuffered.
+func WithBuffers(sizes ...int) FanOutOption {
+	return func(o *fanOutOptions) {
+		o.buffers = sizes
+	}
+}
+
+// WithSlowConsumer sets the policy for the outputs not ready for an item, SlowBlock by default.
+// It does not apply to Compete, where an item only goes to an output ready for it.
+func WithSlowConsumer(policy SlowConsumerPolicy) FanOutOption {
+	return func(o *fanOutOptions) {
+		o.slow = policy
+	}
+}
+
+// buffer returns the buffer size of the output i
+func (o *fanOutOptions) buffer(i int) int {
+	switch {
+	case len(o.buffers) == 1:
+		return max(o.buffers[0], 0)
+	case i < len(o.buffers):
+		return max(o.buffers[i], 0)
+	default:
+		return 0
+	}
+}
+
+// deliver sends item on ch according to the slow consumer policy.
+// It returns false once the context is cancelled.
+func deliver[T any](ctx context.Context, ch chan<- T, item T, slow SlowConsumerPolicy) bool {
+	if slow == SlowBlock {
+		return send(ctx, ch, item)
+	}
+
+	select {
+	case ch <- item:
+	default:
+		// The output is not keeping up: the item is dropped for it
+	}
+	return ctx.Err() == nil
+}
+
+// distribute sends the items of source to the outputs chosen by the distribution,
+// from a single goroutine, and closes the outputs once done
+func distribute[T any](ctx context.Context, source <-chan T, outputs []chan T, o fanOutOptions) {
+	var key func(T) string
+	if o.distribution == KeyHash {
+		var ok bool
+		if key, ok = o.key.(func(T) string); !ok {
+			panic(fmt.Sprintf("fanOut: WithKeyHash needs a func(%T) string, got %T", *new(T), o.key))
+		}
+	}
+
+	go func() {
+		defer func() {
+			for _, ch := range outputs {
+				close(ch)
+			}
+		}()
+
+		for seq := 0; ; seq++ {
+			item, ok := receive(ctx, source)
+			if !ok {
+				return
+			}
+
+			switch o.distribution {
+			case Broadcast:
+				for _, ch := range outputs {
+					if !deliver(ctx, ch, item, o.slow) {
+						return
+					}
+				}
+				continue
+			case RoundRobin:
+				ok = deliver(ctx, outputs[seq%len(outputs)], item, o.slow)
+			case KeyHash:
+				h := fnv.New32a()
+				h.Write([]byte(key(item)))
+				ok = deliver(ctx, outputs[h.Sum32()%uint32(len(outputs))], item, o.slow)
+			}
+			if !ok {
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// fanOut distributes items from a single source channel to multiple worker channels,
+// by default with every worker competing for the next item (see WithDistribution).
+// Its goroutines exit when the source is closed or the context is cancelled.
+// It panics when worker is below 1, as no worker could ever drain the source.
+func fanOut[T any](ctx context.Context, source <-chan T, worker int, opts ...FanOutOption) []<-chan T {
+	if worker < 1 {
+		panic(fmt.Sprintf("fanOut: needs at least one worker, got %d", worker))
+	}
+
+	var o fanOutOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	outputs := make([]chan T, worker)
+	channels := make([]<-chan T, worker)
+	for i := range outputs {
+		outputs[i] = make(chan T, o.buffer(i))
+		channels[i] = outputs[i]
+	}
+
+	if o.distribution != Compete {
+		distribute(ctx, source, outputs, o)
+		return channels
+	}
+
+	for _, ch := range outputs {
+		go func(c chan<- T) {
+			defer close(c)
+
+			// Each worker only takes an item once it is ready for it, so there is
+			// no slow consumer to drop items for
+			for {
+				item, ok := receive(ctx, source)
+				if !ok || !send(ctx, c, item) {
+					return
+				}
+			}
+		}(ch)
+	}
+
+	return channels
+}
+
+// fanIn merges multiple worker channels into a single output channel.
+// Its goroutines exit when the worker channels are closed or the context is cancelled.
+func fanIn[T any](ctx context.Context, workerChans []<-chan T) <-chan T {
+	merged := make(chan T)
+	var wg sync.WaitGroup
+
+	for _, ch := range workerChans {
+		wg.Add(1)
+
+		go func(c <-chan T) {
+			defer wg.Done()
+
+			for {
+				item, ok := receive(ctx, c)
+				if !ok || !send(ctx, merged, item) {
+					return
+				}
+			}
+		}(ch)
+	}
+
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+
+	return merged
+}
+
+// send sends item on ch, unless the context is cancelled first
+func send[T any](ctx context.Context, ch chan<- T, item T) bool {
+	select {
+	case ch <- item:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// receive receives an item from ch, unless the context is cancelled first.
+// It returns false once ch is closed or the context is cancelled.
+func receive[T any](ctx context.Context, ch <-chan T) (T, bool) {
+	select {
+	case item, ok := <-ch:
+		return item, ok
+	case <-ctx.Done():
+		var zero T
+		return zero, false
+	}
+}
@@ -1,124 +1,248 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"iter"
+	"strings"
 	"sync"
 	"time"
 )
 
-// fanOut distributes items from a single source channel to multiple worker channels.
-func fanOut[T any](source <-chan T, worker int) []<-chan T {
-	channels := make([]<-chan T, worker)
+// errUnlucky is returned by slowProcessor for the items it refuses
+var errUnlucky = errors.New("unlucky number")
 
-	for i := 0; i < worker; i++ {
-		ch := make(chan T)
-		channels[i] = ch
-
-		go func(c chan<- T) {
-			defer close(c)
-
-			for item := range source {
-				c <- item
-			}
-		}(ch)
+// Simple processor function that simulates work, and fails on multiples of 13
+// when strict is set in the context
+func slowProcessor(ctx context.Context, x int) (int, error) {
+	select {
+	case <-time.After(100 * time.Millisecond): // Simulate work
+	case <-ctx.Done():
+		return 0, ctx.Err()
 	}
 
-	return channels
+	if strict, _ := ctx.Value(strictKey{}).(bool); strict && x%13 == 0 {
+		return 0, fmt.Errorf("%d: %w", x, errUnlucky)
+	}
+	return x * x, nil
 }
 
-// fanIn merges multiple worker channels into a single output channel.
-func fanIn[T any](workerChans []<-chan T) <-chan T {
-	merged := make(chan T)
-	var wg sync.WaitGroup
+// strictKey is the context key making slowProcessor fail on unlucky numbers
+type strictKey struct{}
 
-	for _, ch := range workerChans {
-		wg.Add(1)
+func main() {
+	ctx := context.Background()
 
-		go func(c <-chan T) {
-			defer wg.Done()
+	// create a slice of items to process
+	items := make([]int, 100)
 
-			for item := range c {
-				merged <- item
-			}
-		}(ch)
+	for i := range items {
+		items[i] = i + 1
 	}
 
-	go func() {
-		wg.Wait()
-		close(merged)
-	}()
+	fmt.Println("Starting processing...")
+	start := time.Now()
 
-	return merged
-}
+	// process items using fan-out/fan-in pattern, results in completion order
+	results, err := processItems(ctx, items, slowProcessor, 10)
+
+	elapsed := time.Since(start)
+	fmt.Printf("Unordered processing completed in %s (err: %v), first results: %v\n", elapsed, err, results[:5])
+
+	// process the same items in ordered mode, results in input order
+	start = time.Now()
+	results, err = processItems(ctx, items, slowProcessor, 10, Ordered())
 
-func processItems[T any](items []T, processor func(T) T, worker int) []T {
-	// Create a source channel and send all items to it
-	source := make(chan T)
+	elapsed = time.Since(start)
+	fmt.Printf("Ordered processing completed in %s (err: %v)\n", elapsed, err)
+
+	// Verify every result against its input
+	for i, item := range items {
+		if results[i] != item*item {
+			fmt.Printf("Result %d: got %d, want %d\n", i, results[i], item*item)
+			return
+		}
+	}
+	fmt.Println("All results match their input")
+
+	// The first failure cancels the items not processed yet
+	strict := context.WithValue(ctx, strictKey{}, true)
+	start = time.Now()
+	results, err = processItems(strict, items, slowProcessor, 10)
+	fmt.Printf("Fail fast: %d results in %s, err: %v\n", len(results), time.Since(start), err)
+
+	// Or every item is processed and all the failures are reported
+	results, err = processItems(strict, items, slowProcessor, 10, CollectErrors())
+	fmt.Printf("Collect errors: %d results, unlucky: %v, err:\n%v\n", len(results), errors.Is(err, errUnlucky), err)
+
+	// A deadline cancels the whole processing
+	timeout, cancel := context.WithTimeout(ctx, 250*time.Millisecond)
+	defer cancel()
+	results, err = processItems(timeout, items, slowProcessor, 10, Ordered())
+	fmt.Printf("Deadline: %d results, err: %v\n", len(results), err)
+
+	pipeline(ctx)
+	distributions(ctx)
+	streaming(ctx)
+}
 
+// streaming shows unbounded inputs processed as a stream: log lines read from a
+// reader as they are written, and an endless sequence cut short by cancellation
+func streaming(ctx context.Context) {
+	// A log file being written to
+	reader, writer := io.Pipe()
 	go func() {
-		defer close(source)
+		defer writer.Close()
 
-		for _, item := range items {
-			source <- item
+		for i, line := range []string{"INFO started", "WARN disk at 80%", "garbage", "ERROR disk full", "INFO stopped"} {
+			time.Sleep(20 * time.Millisecond)
+			fmt.Fprintf(writer, "%s #%d\n", line, i)
 		}
 	}()
 
-	// Fan out processing
-	channels := fanOut(source, worker)
-
-	// Process items in parallel
-	processedChannels := make([]<-chan T, worker)
-	for i, ch := range channels {
-		processedCh := make(chan T)
-		processedChannels[i] = processedCh
+	lines, waitScan := scanLines(ctx, reader)
+	entries := processStream(ctx, lines, func(ctx context.Context, line string) (string, error) {
+		level, message, found := strings.Cut(line, " ")
+		if !found || strings.ToUpper(level) != level {
+			return "", fmt.Errorf("malformed line %q", line)
+		}
+		return fmt.Sprintf("[%-5s] %s", level, message), nil
+	}, 4, Ordered())
 
-		go func(in <-chan T, out chan<- T) {
-			defer close(out)
+	for entry := range entries {
+		if entry.Err != nil {
+			fmt.Printf("Line %d skipped: %v\n", entry.Index, entry.Err)
+			continue
+		}
+		fmt.Println(entry.Value)
+	}
+	if err := waitScan(); err != nil {
+		fmt.Println("Scan failed:", err)
+	}
 
-			for item := range in {
-				out <- processor(item)
-			}
-		}(ch, processedCh)
+	// An endless sequence: only the items in flight are held in memory
+	naturals := func(yield func(int) bool) {
+		for i := 1; yield(i); i++ {
+		}
 	}
+	squares(ctx, naturals, 10)
+}
 
-	// Merge processed channels back into a single output channel
-	results := fanIn(processedChannels)
+// squares prints the squares of the first n values of seq, then cancels the stream
+func squares(ctx context.Context, seq iter.Seq[int], n int) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	// Collect processed items from the merged channel
-	var processed []T
-	for item := range results {
-		processed = append(processed, item)
-	}
+	results := processStream(ctx, fromSeq(ctx, seq), slowProcessor, 4, Ordered())
 
-	return processed
+	var values []int
+	for result := range results {
+		values = append(values, result.Value)
+		if len(values) == n {
+			break
+		}
+	}
+	fmt.Println("First squares:", values)
 }
 
-// Simple processor function that simulates work
-func slowProcessor(x int) int {
-	time.Sleep(100 * time.Millisecond) // Simulate work
-	return x * x
+// Order is an event distributed to several consumers
+type Order struct {
+	Customer string
+	ID       int
 }
 
-func main() {
-	// create a slice of items to process
-	items := make([]int, 100)
+// distributions shows the fanOut strategies other than competing consumers
+func distributions(ctx context.Context) {
+	orders := func() <-chan Order {
+		source := make(chan Order)
+		go func() {
+			defer close(source)
+
+			for i := 0; i < 12; i++ {
+				if !send(ctx, source, Order{Customer: []string{"alice", "bob", "carol"}[i%3], ID: i}) {
+					return
+				}
+			}
+		}()
+		return source
+	}
 
-	for i := range items {
-		items[i] = i + 1
+	// consume reads every output concurrently and reports what each one received
+	consume := func(name string, outputs []<-chan Order, delay time.Duration) {
+		received := make([][]int, len(outputs))
+		var wg sync.WaitGroup
+		for i, out := range outputs {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				for order := range out {
+					time.Sleep(delay * time.Duration(i)) // The later outputs are slower
+					received[i] = append(received[i], order.ID)
+				}
+			}()
+		}
+		wg.Wait()
+		fmt.Printf("%s: %v\n", name, received)
 	}
 
-	fmt.Println("Starting processing...")
-	start := time.Now()
+	// Broadcast tees every order to an audit log and a slow metrics sink,
+	// which drops the orders it cannot keep up with instead of slowing the audit down
+	consume("Broadcast", fanOut(ctx, orders(), 2,
+		WithDistribution(Broadcast), WithBuffers(16, 2), WithSlowConsumer(SlowDrop)), 10*time.Millisecond)
 
-	// process items using fan-out/fan-in pattern
-	results := processItems(items, slowProcessor, 10)
+	// Round-robin spreads the orders evenly, whatever the speed of the outputs
+	consume("Round-robin", fanOut(ctx, orders(), 3, WithDistribution(RoundRobin), WithBuffers(4)), 0)
 
-	elapsed := time.Since(start)
-	fmt.Printf("Processing completed in %s\n", elapsed)
+	// Key-hash keeps all the orders of a customer on the same output, in order
+	consume("Key-hash", fanOut(ctx, orders(), 2, WithKeyHash(func(o Order) string { return o.Customer })), 0)
+}
+
+// User is the record decoded by the pipeline
+type User struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+// pipeline chains stages of different types: raw JSON is decoded into users,
+// then users are formatted into greetings, both stages keeping the input order
+func pipeline(ctx context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	raw := make(chan []byte)
+	go func() {
+		defer close(raw)
+
+		for _, line := range []string{
+			`{"name":"alice","age":31}`,
+			`{"name":"bob","age":27}`,
+			`{"name":"carol","age":45}`,
+			`{"name":"dave","age":38}`,
+		} {
+			if !send(ctx, raw, []byte(line)) {
+				return
+			}
+		}
+	}()
 
-	// Verify few results
-	fmt.Println("Processed results:")
-	for i := 0; i < 5; i++ {
-		fmt.Printf("Result %d: %d\n", i, results[i])
+	users, waitDecode := ParallelMap(ctx, raw, func(ctx context.Context, data []byte) (User, error) {
+		var u User
+		err := json.Unmarshal(data, &u)
+		return u, err
+	}, 2, Ordered())
+
+	greetings, waitGreet := ParallelMap(ctx, users, func(ctx context.Context, u User) (string, error) {
+		return fmt.Sprintf("Hello %s (%d)", strings.ToUpper(u.Name[:1])+u.Name[1:], u.Age), nil
+	}, 2, Ordered())
+
+	for greeting := range greetings {
+		fmt.Println(greeting)
+	}
+	if err := errors.Join(waitDecode(), waitGreet()); err != nil {
+		fmt.Println("Pipeline failed:", err)
 	}
 }
@@ -0,0 +1,95 @@
+package main
+
+import "context"
+
+// Option configures a call to processItems or ParallelMap
+type Option func(*options)
+
+// options holds the settings of a call to processItems or ParallelMap
+type options struct {
+	ordered bool
+	window  int
+	collect bool
+}
+
+// newOptions applies opts over the defaults for worker workers
+func newOptions(worker int, opts []Option) options {
+	o := options{window: 2 * worker}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	o.window = max(o.window, 1)
+
+	return o
+}
+
+// Ordered returns the results in input order instead of completion order
+func Ordered() Option {
+	return func(o *options) {
+		o.ordered = true
+	}
+}
+
+// WithReorderBuffer bounds the number of results held back while waiting for an earlier one
+// in ordered mode, which is also the number of items in flight. It defaults to twice the
+// number of workers; below the number of workers, some workers stay idle.
+func WithReorderBuffer(size int) Option {
+	return func(o *options) {
+		o.window = size
+	}
+}
+
+// CollectErrors keeps processing the items after a failure and returns all the errors
+// joined, instead of cancelling the remaining items at the first error
+func CollectErrors() Option {
+	return func(o *options) {
+		o.collect = true
+	}
+}
+
+// indexed tags an item with its position in the input
+type indexed[T any] struct {
+	index int
+	value T
+}
+
+// Result is the outcome of the processing of the item at Index in the input
+type Result[T any] struct {
+	Index int
+	Value T
+	Err   error
+}
+
+// reorder emits the results of in sorted by index, starting from 0. Every result emitted
+// releases a slot of window, which the producer acquires before sending an item: at most
+// cap(window) results are held back, and the one they wait for is always in flight.
+// Its goroutine exits when in is closed or the context is cancelled.
+func reorder[T any](ctx context.Context, in <-chan Result[T], window <-chan struct{}) <-chan Result[T] {
+	out := make(chan Result[T])
+
+	go func() {
+		defer close(out)
+
+		pending := make(map[int]Result[T], cap(window))
+		next := 0
+		for res := range in {
+			pending[res.Index] = res
+
+			for {
+				res, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+				next++
+
+				if !send(ctx, out, res) {
+					return
+				}
+				<-window
+			}
+		}
+	}()
+
+	return out
+}
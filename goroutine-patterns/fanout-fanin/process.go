@@ -0,0 +1,43 @@
+package main
+
+import "context"
+
+// processItems processes items in parallel with worker goroutines using the
+// fan-out/fan-in pattern, the items being converted from In to Out by processor.
+// Results come in completion order, or in input order with the Ordered option.
+//
+// The first error cancels the items not processed yet and is returned with the
+// results collected so far. With the CollectErrors option every item is processed
+// and all the errors are returned joined; the failed items are left out of the
+// results, or kept as zero values in ordered mode so that results[i] matches items[i].
+// Every internal goroutine exits once the context is cancelled. For inputs too large
+// to be held in a slice, processStream processes a channel instead.
+func processItems[In, Out any](ctx context.Context, items []In, processor func(context.Context, In) (Out, error), worker int, opts ...Option) ([]Out, error) {
+	o := newOptions(worker, opts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Create a source channel and send all items to it
+	source := make(chan In)
+
+	go func() {
+		defer close(source)
+
+		for _, item := range items {
+			if !send(ctx, source, item) {
+				return
+			}
+		}
+	}()
+
+	// Collect processed items from the fan-out/fan-in stage
+	processed := make([]Out, 0, len(items))
+	err := collect(ctx, mapStage(ctx, source, processor, worker, o), o, cancel, func(res Result[Out]) {
+		if res.Err == nil || o.ordered {
+			processed = append(processed, res.Value)
+		}
+	})
+
+	return processed, err
+}
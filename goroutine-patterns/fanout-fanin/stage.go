@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ParallelMap is a pipeline stage applying processor to the items of in with worker
+// goroutines, using the fan-out/fan-in pattern. Stages of different types chain
+// through their channels, the output of one being the input of the next.
+//
+// The output channel is closed once in is closed and drained, or at the first error,
+// or when the context is cancelled; wait then returns the error of the stage, as
+// processItems does. Failed items are left out of the output. The stages of a
+// pipeline usually share a context, cancelled by the caller to stop the upstream
+// stages when a downstream one fails.
+func ParallelMap[In, Out any](ctx context.Context, in <-chan In, processor func(context.Context, In) (Out, error), worker int, opts ...Option) (<-chan Out, func() error) {
+	o := newOptions(worker, opts)
+
+	ctx, cancel := context.WithCancel(ctx)
+	results := mapStage(ctx, in, processor, worker, o)
+
+	out := make(chan Out)
+	done := make(chan struct{})
+	var err error
+
+	go func() {
+		defer close(done)
+		defer close(out)
+		defer cancel()
+
+		err = collect(ctx, results, o, cancel, func(res Result[Out]) {
+			if res.Err == nil {
+				send(ctx, out, res.Value)
+			}
+		})
+	}()
+
+	wait := func() error {
+		<-done
+		return err
+	}
+
+	return out, wait
+}
+
+// mapStage runs processor over the items of in with worker goroutines, and emits
+// their results tagged with the index of the item, in completion or input order.
+// Every goroutine exits once the context is cancelled.
+func mapStage[In, Out any](ctx context.Context, in <-chan In, processor func(context.Context, In) (Out, error), worker int, o options) <-chan Result[Out] {
+	// Tag every item with its index in a source channel.
+	// In ordered mode, each item takes a slot of the reorder window first.
+	source := make(chan indexed[In])
+	window := make(chan struct{}, o.window)
+
+	go func() {
+		defer close(source)
+
+		for i := 0; ; i++ {
+			item, ok := receive(ctx, in)
+			if !ok {
+				return
+			}
+			if o.ordered && !send(ctx, window, struct{}{}) {
+				return
+			}
+			if !send(ctx, source, indexed[In]{index: i, value: item}) {
+				return
+			}
+		}
+	}()
+
+	// Fan out processing
+	channels := fanOut(ctx, source, worker)
+
+	// Process items in parallel
+	processedChannels := make([]<-chan Result[Out], worker)
+	for i, ch := range channels {
+		processedCh := make(chan Result[Out])
+		processedChannels[i] = processedCh
+
+		go func(in <-chan indexed[In], out chan<- Result[Out]) {
+			defer close(out)
+
+			for item := range in {
+				value, err := processor(ctx, item.value)
+				if !send(ctx, out, Result[Out]{Index: item.index, Value: value, Err: err}) {
+					return
+				}
+			}
+		}(ch, processedCh)
+	}
+
+	// Merge processed channels back into a single output channel
+	results := fanIn(ctx, processedChannels)
+	if o.ordered {
+		results = reorder(ctx, results, window)
+	}
+
+	return results
+}
+
+// collect consumes the results, passes them to keep and returns the error of the call.
+// The first error cancels the remaining items, unless the CollectErrors option is set:
+// then the failed results are kept too, with a zero value, and all the errors are joined.
+func collect[T any](ctx context.Context, results <-chan Result[T], o options, cancel context.CancelFunc, keep func(Result[T])) error {
+	var errs []error
+	for res := range results {
+		if len(errs) > 0 && !o.collect {
+			// Draining the items cancelled by the first error
+			continue
+		}
+
+		if res.Err != nil {
+			errs = append(errs, fmt.Errorf("item %d: %w", res.Index, res.Err))
+			if !o.collect {
+				cancel()
+				continue
+			}
+			var zero T
+			res.Value = zero
+		}
+		keep(res)
+	}
+
+	switch {
+	case len(errs) > 0:
+		return errors.Join(errs...)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"iter"
+)
+
+// processStream is the streaming variant of processItems: it processes the items
+// of in as they arrive and emits their results, in completion order or in input order
+// with the Ordered option. The channel is closed once in is closed and drained, or
+// the context is cancelled.
+//
+// Errors are reported on their Result instead of stopping the stream, so that an
+// unbounded input keeps flowing; the caller cancels the context to stop it.
+// Memory stays bounded by the number of workers, and the reorder buffer in ordered mode.
+func processStream[In, Out any](ctx context.Context, in <-chan In, processor func(context.Context, In) (Out, error), worker int, opts ...Option) <-chan Result[Out] {
+	return mapStage(ctx, in, processor, worker, newOptions(worker, opts))
+}
+
+// scanLines sends the lines of r, without their end of line, to a channel closed at the
+// end of r or when the context is cancelled. wait returns the error of the scan, if any,
+// once the channel is closed. Lines are read as they are consumed, up to bufio.MaxScanTokenSize.
+func scanLines(ctx context.Context, r io.Reader) (<-chan string, func() error) {
+	lines := make(chan string)
+	done := make(chan struct{})
+	var err error
+
+	go func() {
+		defer close(done)
+		defer close(lines)
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if !send(ctx, lines, scanner.Text()) {
+				return
+			}
+		}
+		err = scanner.Err()
+	}()
+
+	wait := func() error {
+		<-done
+		return err
+	}
+
+	return lines, wait
+}
+
+// fromSeq sends the values of seq to a channel closed at the end of seq or when the
+// context is cancelled. Values are pulled from seq as they are consumed.
+func fromSeq[T any](ctx context.Context, seq iter.Seq[T]) <-chan T {
+	values := make(chan T)
+
+	go func() {
+		defer close(values)
+
+		for value := range seq {
+			if !send(ctx, values, value) {
+				return
+			}
+		}
+	}()
+
+	return values
+}
@@ -0,0 +1,142 @@
+package future
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoFutures is the error of Any and Race when called without futures
+var ErrNoFutures = errors.New("future: no futures given")
+
+// All settles with the values of every future, in order, once they all succeeded.
+// It fails with the first error, and then cancels the futures still pending.
+// Cancelling the result cancels every future.
+func All[T any](futures ...*Future[T]) *Future[[]T] {
+	p := NewPromise[[]T](func() { cancelAll(futures) })
+
+	go func() {
+		values := make([]T, len(futures))
+		errs := make(chan error, len(futures))
+
+		for i, f := range futures {
+			go func() {
+				<-f.Done()
+				values[i] = f.value
+				errs <- f.err
+			}()
+		}
+
+		for range futures {
+			if err := <-errs; err != nil {
+				p.Reject(err)
+				cancelAll(futures)
+				return
+			}
+		}
+		p.Resolve(values)
+	}()
+
+	return p.Future()
+}
+
+// Any settles with the first future that succeeds and cancels the others.
+// If every future fails, it fails with all their errors joined.
+func Any[T any](futures ...*Future[T]) *Future[T] {
+	if len(futures) == 0 {
+		return Failed[T](ErrNoFutures)
+	}
+
+	p := NewPromise[T](func() { cancelAll(futures) })
+
+	go func() {
+		settled := make(chan *Future[T], len(futures))
+		for _, f := range futures {
+			go func() {
+				<-f.Done()
+				settled <- f
+			}()
+		}
+
+		var errs []error
+		for range futures {
+			f := <-settled
+			if f.err == nil {
+				p.Resolve(f.value)
+				cancelAll(futures)
+				return
+			}
+			errs = append(errs, f.err)
+		}
+		p.Reject(errors.Join(errs...))
+	}()
+
+	return p.Future()
+}
+
+// Race settles like the first future to settle, success or failure, and cancels the others
+func Race[T any](futures ...*Future[T]) *Future[T] {
+	if len(futures) == 0 {
+		return Failed[T](ErrNoFutures)
+	}
+
+	p := NewPromise[T](func() { cancelAll(futures) })
+
+	for _, f := range futures {
+		go func() {
+			<-f.Done()
+			if p.Complete(f.value, f.err) {
+				cancelAll(futures)
+			}
+		}()
+	}
+
+	return p.Future()
+}
+
+// Then chains fn after f: once f succeeds, fn runs with its value under ctx.
+// An error of f is passed through without calling fn.
+func Then[T, U any](ctx context.Context, f *Future[T], fn func(context.Context, T) (U, error)) *Future[U] {
+	return Go(ctx, func(ctx context.Context) (U, error) {
+		value, err := f.Result(ctx)
+		if err != nil {
+			return *new(U), err
+		}
+		return fn(ctx, value)
+	})
+}
+
+// Map transforms the value of f once it succeeds
+func Map[T, U any](f *Future[T], fn func(T) U) *Future[U] {
+	return Then(context.Background(), f, func(_ context.Context, value T) (U, error) {
+		return fn(value), nil
+	})
+}
+
+// WithTimeout settles like f, or fails with context.DeadlineExceeded and cancels f
+// if f is not settled within timeout
+func WithTimeout[T any](f *Future[T], timeout time.Duration) *Future[T] {
+	p := NewPromise[T](f.Cancel)
+
+	go func() {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-f.Done():
+			p.Complete(f.value, f.err)
+		case <-timer.C:
+			p.Reject(context.DeadlineExceeded)
+			f.Cancel()
+		}
+	}()
+
+	return p.Future()
+}
+
+// cancelAll cancels every future
+func cancelAll[T any](futures []*Future[T]) {
+	for _, f := range futures {
+		f.Cancel()
+	}
+}
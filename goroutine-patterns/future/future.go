@@ -0,0 +1,148 @@
+// Package future provides a generic one-shot Future, the read side of a result
+// computed concurrently, and the Promise that completes it.
+package future
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync"
+)
+
+// Future is the result of an asynchronous computation, available once Done is closed
+type Future[T any] struct {
+	done   chan struct{}
+	once   sync.Once
+	value  T
+	err    error
+	cancel context.CancelFunc
+}
+
+// Promise is the write side of a Future: the first call to Complete, Resolve or Reject wins
+type Promise[T any] struct {
+	future *Future[T]
+}
+
+// NewPromise creates a pending Future and its Promise.
+// cancel, which may be nil, is called by Future.Cancel to abort the computation.
+func NewPromise[T any](cancel context.CancelFunc) *Promise[T] {
+	if cancel == nil {
+		cancel = func() {}
+	}
+
+	return &Promise[T]{future: &Future[T]{done: make(chan struct{}), cancel: cancel}}
+}
+
+// Future returns the Future completed by the promise
+func (p *Promise[T]) Future() *Future[T] {
+	return p.future
+}
+
+// Complete settles the Future with a value and an error.
+// It returns false if the Future was already settled.
+func (p *Promise[T]) Complete(value T, err error) bool {
+	settled := false
+	p.future.once.Do(func() {
+		p.future.value, p.future.err = value, err
+		close(p.future.done)
+		settled = true
+	})
+
+	return settled
+}
+
+// Resolve settles the Future with a value
+func (p *Promise[T]) Resolve(value T) bool {
+	return p.Complete(value, nil)
+}
+
+// Reject settles the Future with an error
+func (p *Promise[T]) Reject(err error) bool {
+	return p.Complete(*new(T), err)
+}
+
+// Go runs fn in a new goroutine and returns the Future of its result.
+// fn gets a context derived from ctx and cancelled by Future.Cancel.
+// A panic in fn is recovered and turned into the error of the Future.
+func Go[T any](ctx context.Context, fn func(context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithCancel(ctx)
+	p := NewPromise[T](cancel)
+
+	go func() {
+		defer cancel()
+		defer func() {
+			if r := recover(); r != nil {
+				p.Reject(&PanicError{Value: r, Stack: debug.Stack()})
+			}
+		}()
+
+		p.Complete(fn(ctx))
+	}()
+
+	return p.future
+}
+
+// Resolved returns a Future already settled with value
+func Resolved[T any](value T) *Future[T] {
+	p := NewPromise[T](nil)
+	p.Resolve(value)
+	return p.future
+}
+
+// Failed returns a Future already settled with err
+func Failed[T any](err error) *Future[T] {
+	p := NewPromise[T](nil)
+	p.Reject(err)
+	return p.future
+}
+
+// Done returns a channel closed once the Future is settled
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Result waits for the Future and returns its value and error, or the context
+// error if ctx is done first. It can be called any number of times.
+func (f *Future[T]) Result(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return *new(T), ctx.Err()
+	}
+}
+
+// Peek returns the value and error of a settled Future, ok is false while it is pending
+func (f *Future[T]) Peek() (value T, err error, ok bool) {
+	select {
+	case <-f.done:
+		return f.value, f.err, true
+	default:
+		return *new(T), nil, false
+	}
+}
+
+// Cancel asks the computation behind the Future to stop. The Future is settled
+// by the computation itself, usually with a context error.
+func (f *Future[T]) Cancel() {
+	f.cancel()
+}
+
+// PanicError is the error of a Future whose function panicked
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("future: function panicked: %v", e.Value)
+}
+
+// Unwrap exposes the panic value when it is an error
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"future"
+)
+
+// JobID identifies a job submitted with SubmitAsync
+type JobID uint64
+
+// JobStatus is the stage of a job submitted with SubmitAsync
+type JobStatus int32
+
+const (
+	JobQueued JobStatus = iota
+	JobRunning
+	JobDone
+	JobCancelled
+)
+
+// String returns the name of the status
+func (s JobStatus) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobDone:
+		return "done"
+	case JobCancelled:
+		return "cancelled"
+	default:
+		return "unknown"
+	}
+}
+
+// jobState is shared between a Future and the worker running its job
+type jobState struct {
+	status    atomic.Int32
+	cancelled atomic.Bool
+}
+
+// cancel marks the job as cancelled and cancels its context: a queued job
+// will not run, a running job sees its context cancelled
+func (s *jobState) cancel(cancelCtx context.CancelFunc) {
+	s.cancelled.Store(true)
+	s.status.CompareAndSwap(int32(JobQueued), int32(JobCancelled))
+	cancelCtx()
+}
+
+// settle records the final status of a job from its error
+func (s *jobState) settle(err error) {
+	status := JobDone
+	if s.cancelled.Load() && err != nil {
+		status = JobCancelled
+	}
+	s.status.Store(int32(status))
+}
+
+// Future is the handle of a job submitted with SubmitAsync. It embeds a
+// future.Future, so it is awaited with Done and Result, cancelled with Cancel,
+// and can be combined with the helpers of the future package such as future.All.
+type Future[Out any] struct {
+	*future.Future[Out]
+	id    JobID
+	state *jobState
+}
+
+// ID returns the id of the job, to be used with WorkerPool.Cancel
+func (f *Future[Out]) ID() JobID {
+	return f.id
+}
+
+// Status returns the current stage of the job
+func (f *Future[Out]) Status() JobStatus {
+	return JobStatus(f.state.status.Load())
+}
+
+// SubmitAsync queues the input and returns at once with a Future to follow the job.
+// It only blocks while the job waits for the rate limits or, with the Block policy,
+// for room in the queue; under CallerRuns it returns the Future of a job already done.
+// The job runs under ctx, which is also cancelled by Future.Cancel and WorkerPool.Cancel.
+func (p *WorkerPool[In, Out]) SubmitAsync(ctx context.Context, input In) (*Future[Out], error) {
+	ctx, cancelCtx := context.WithCancel(ctx)
+	state := &jobState{}
+	job := Job[In, Out]{
+		Ctx:      ctx,
+		Input:    input,
+		Priority: PriorityNormal,
+		Result:   make(chan Result[Out], 1),
+		state:    state,
+	}
+
+	err := p.submit(&job)
+	if err != nil && !errors.Is(err, errRunInCaller) {
+		cancelCtx()
+		return nil, err
+	}
+
+	promise := future.NewPromise[Out](func() { state.cancel(cancelCtx) })
+	f := &Future[Out]{Future: promise.Future(), id: JobID(job.id), state: state}
+	complete := func(value Out, err error) {
+		state.settle(err)
+		cancelCtx()
+		promise.Complete(value, err)
+	}
+
+	if errors.Is(err, errRunInCaller) {
+		complete(p.execute(nil, job))
+		return f, nil
+	}
+
+	// Register the future before waiting, so that the registration never outlives the job
+	p.futures.Store(f.id, f.Cancel)
+	go func() {
+		result := <-job.Result
+		p.futures.Delete(f.id)
+		complete(result.Value, result.Err)
+	}()
+
+	return f, nil
+}
+
+// Cancel cancels the pending job with the given id, as returned by Future.ID.
+// It returns false when no such job is queued or running.
+func (p *WorkerPool[In, Out]) Cancel(id JobID) bool {
+	cancel, ok := p.futures.Load(id)
+	if !ok {
+		return false
+	}
+
+	cancel.(func())()
+	return true
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"sync"
+)
+
+// SubmitBatch submits every input to the pool and waits for all of them.
+// Outputs and errors are returned in the order of the inputs: errs[i] is the
+// error of inputs[i] and outs[i] its output when errs[i] is nil.
+func (p *WorkerPool[In, Out]) SubmitBatch(ctx context.Context, inputs []In) ([]Out, []error) {
+	outs := make([]Out, len(inputs))
+	errs := make([]error, len(inputs))
+
+	var wg sync.WaitGroup
+	for i, input := range inputs {
+		wg.Add(1)
+		go func(i int, input In) {
+			defer wg.Done()
+			outs[i], errs[i] = p.Submit(ctx, input)
+		}(i, input)
+	}
+	wg.Wait()
+
+	return outs, errs
+}
+
+// streamOptions holds the settings of a Stream call
+type streamOptions struct {
+	ordered  bool
+	inFlight int
+}
+
+// StreamOption configures a Stream call
+type StreamOption func(*streamOptions)
+
+// StreamOrdered makes Stream emit the results in the order of the inputs.
+// A slow job then holds back the results of the jobs submitted after it.
+func StreamOrdered() StreamOption {
+	return func(o *streamOptions) {
+		o.ordered = true
+	}
+}
+
+// StreamMaxInFlight bounds how many inputs are submitted to the pool at the same time.
+// It defaults to the size of the pool.
+func StreamMaxInFlight(n int) StreamOption {
+	return func(o *streamOptions) {
+		if n > 0 {
+			o.inFlight = n
+		}
+	}
+}
+
+// Stream feeds every value received on inputs through the pool and emits the results
+// on the returned channel, in completion order unless StreamOrdered is given.
+// Result.Index is the position of the input in the stream.
+// The returned channel is closed once inputs is closed and every result has been
+// emitted, or as soon as ctx is done.
+func (p *WorkerPool[In, Out]) Stream(ctx context.Context, inputs <-chan In, opts ...StreamOption) <-chan Result[Out] {
+	o := streamOptions{inFlight: p.Size()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.ordered {
+		return p.streamOrdered(ctx, inputs, o.inFlight)
+	}
+	return p.streamUnordered(ctx, inputs, o.inFlight)
+}
+
+// streamUnordered emits each result as soon as its job completes
+func (p *WorkerPool[In, Out]) streamUnordered(ctx context.Context, inputs <-chan In, inFlight int) <-chan Result[Out] {
+	out := make(chan Result[Out])
+	sem := make(chan struct{}, inFlight)
+
+	go func() {
+		var wg sync.WaitGroup
+		defer func() {
+			wg.Wait()
+			close(out)
+		}()
+
+		for index := 0; ; index++ {
+			input, ok := receive(ctx, inputs)
+			if !ok {
+				return
+			}
+
+			// Wait for a free slot before submitting the next input
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			wg.Add(1)
+			go func(index int, input In) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				value, err := p.Submit(ctx, input)
+				select {
+				case out <- Result[Out]{Index: index, Value: value, Err: err}:
+				case <-ctx.Done():
+				}
+			}(index, input)
+		}
+	}()
+
+	return out
+}
+
+// streamOrdered emits the results in input order. Every submitted input gets its own
+// result channel, queued in order in pending, whose capacity bounds the inputs in flight.
+func (p *WorkerPool[In, Out]) streamOrdered(ctx context.Context, inputs <-chan In, inFlight int) <-chan Result[Out] {
+	out := make(chan Result[Out])
+	pending := make(chan chan Result[Out], inFlight)
+
+	// Submit the inputs in order
+	go func() {
+		defer close(pending)
+
+		for index := 0; ; index++ {
+			input, ok := receive(ctx, inputs)
+			if !ok {
+				return
+			}
+
+			result := make(chan Result[Out], 1)
+			select {
+			case pending <- result:
+			case <-ctx.Done():
+				return
+			}
+
+			go func(index int, input In) {
+				value, err := p.Submit(ctx, input)
+				result <- Result[Out]{Index: index, Value: value, Err: err}
+			}(index, input)
+		}
+	}()
+
+	// Emit the results in the same order
+	go func() {
+		defer close(out)
+
+		for result := range pending {
+			select {
+			case r := <-result:
+				select {
+				case out <- r:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// receive reads the next input, returning false when the channel is closed or ctx is done
+func receive[In any](ctx context.Context, inputs <-chan In) (In, bool) {
+	select {
+	case input, ok := <-inputs:
+		return input, ok
+	case <-ctx.Done():
+		return *new(In), false
+	}
+}
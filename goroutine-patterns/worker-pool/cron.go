@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed cron expression: minute hour day-of-month month day-of-week,
+// or an @every interval
+type cronSchedule struct {
+	every time.Duration // set for "@every <duration>", the fields are unused then
+
+	minute, hour, dom, month, dow uint64 // bitsets of the allowed values
+	domAny, dowAny                bool   // the field was "*", see matchDay
+}
+
+// cronAliases are the predefined schedules
+var cronAliases = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// parseCron parses a standard 5 field cron expression. Each field accepts "*",
+// values, ranges "a-b", lists "a,b" and steps "*/n" or "a-b/n"; day-of-week 7 is Sunday.
+// The aliases @yearly, @monthly, @weekly, @daily, @hourly and "@every <duration>" are also accepted.
+func parseCron(spec string) (cronSchedule, error) {
+	spec = strings.TrimSpace(spec)
+	if alias, ok := cronAliases[spec]; ok {
+		spec = alias
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || every <= 0 {
+			return cronSchedule{}, fmt.Errorf("workerpool: invalid cron interval %q", rest)
+		}
+		return cronSchedule{every: every}, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return cronSchedule{}, fmt.Errorf("workerpool: cron expression %q must have 5 fields", spec)
+	}
+
+	var (
+		c   cronSchedule
+		err error
+	)
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return cronSchedule{}, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return cronSchedule{}, err
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return cronSchedule{}, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return cronSchedule{}, err
+	}
+	if c.dow, err = parseCronField(fields[4], 0, 7); err != nil {
+		return cronSchedule{}, err
+	}
+
+	// Sunday is both 0 and 7
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	c.domAny = fields[2] == "*"
+	c.dowAny = fields[4] == "*"
+
+	return c, nil
+}
+
+// parseCronField returns the bitset of the values allowed by a cron field
+func parseCronField(field string, lo, hi int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		rng, stepText, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepText)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("workerpool: invalid cron step in %q", field)
+			}
+			step = n
+		}
+
+		start, end := lo, hi
+		switch {
+		case rng == "*":
+		case strings.Contains(rng, "-"):
+			a, b, _ := strings.Cut(rng, "-")
+			var errA, errB error
+			start, errA = strconv.Atoi(a)
+			end, errB = strconv.Atoi(b)
+			if errA != nil || errB != nil {
+				return 0, fmt.Errorf("workerpool: invalid cron range in %q", field)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil {
+				return 0, fmt.Errorf("workerpool: invalid cron value in %q", field)
+			}
+			start = n
+			if !hasStep {
+				end = n
+			}
+		}
+
+		if start < lo || end > hi || start > end {
+			return 0, fmt.Errorf("workerpool: cron field %q out of range %d-%d", field, lo, hi)
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+// next returns the first activation strictly after t, or the zero time if there is
+// none within five years (e.g. "0 0 30 2 *")
+func (c cronSchedule) next(t time.Time) time.Time {
+	if c.every > 0 {
+		return t.Add(c.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// matchDay applies the cron rule for days: when both day-of-month and day-of-week
+// are restricted, a day matching either of them is selected
+func (c cronSchedule) matchDay(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dow
+	case c.dowAny:
+		return dom
+	default:
+		return dom || dow
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+		"@every",
+		"@every -1m",
+		"@every soon",
+		"@fortnightly",
+	} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", spec)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	// 2024-01-15 is a Monday
+	from := time.Date(2024, time.January, 15, 10, 30, 20, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"* * * * *", from, at(time.January, 15, 10, 31)},
+		{"0 * * * *", from, at(time.January, 15, 11, 0)},
+		{"@hourly", from, at(time.January, 15, 11, 0)},
+		{"@daily", from, at(time.January, 16, 0, 0)},
+		{"@weekly", from, at(time.January, 21, 0, 0)},
+		{"@monthly", from, at(time.February, 1, 0, 0)},
+		{"@yearly", from, time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		// Strictly after: an activation at the same minute is skipped
+		{"30 10 * * *", from, at(time.January, 16, 10, 30)},
+		// Lists and ranges
+		{"15,45 * * * *", from, at(time.January, 15, 10, 45)},
+		{"0 9-17 * * *", from, at(time.January, 15, 11, 0)},
+		{"0 18-20 * * *", from, at(time.January, 15, 18, 0)},
+		// Steps
+		{"*/20 * * * *", from, at(time.January, 15, 10, 40)},
+		{"10-50/15 * * * *", from, at(time.January, 15, 10, 40)},
+		{"5/25 * * * *", from, at(time.January, 15, 10, 55)},
+		// Day of week, 7 being Sunday like 0
+		{"0 0 * * 3", from, at(time.January, 17, 0, 0)},
+		{"0 0 * * 7", from, at(time.January, 21, 0, 0)},
+		{"0 0 * * 0", from, at(time.January, 21, 0, 0)},
+		{"0 0 * * 1-5", from, at(time.January, 16, 0, 0)},
+		// Day of month and month
+		{"0 0 20 * *", from, at(time.January, 20, 0, 0)},
+		{"0 0 1 3 *", from, at(time.March, 1, 0, 0)},
+		{"0 0 29 2 *", from, at(time.February, 29, 0, 0)},
+		// Both day fields restricted: either one matches
+		{"0 0 20 * 3", from, at(time.January, 17, 0, 0)},
+		{"0 0 16 * 0", from, at(time.January, 16, 0, 0)},
+		// @every is relative to the given time
+		{"@every 90s", from, from.Add(90 * time.Second)},
+		// No such day
+		{"0 0 30 2 *", from, time.Time{}},
+	}
+
+	for _, tt := range tests {
+		c, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("parseCron(%q): %v", tt.spec, err)
+			continue
+		}
+		if got := c.next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("parseCron(%q).next(%s) = %s, want %s", tt.spec, tt.from, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// DeadLetter is a job that failed for good, with the error of every attempt
+type DeadLetter[In any] struct {
+	Input    In
+	Errors   []error
+	FailedAt time.Time
+}
+
+// Attempts returns the number of attempts made for the job
+func (d DeadLetter[In]) Attempts() int {
+	return len(d.Errors)
+}
+
+// DeadLetterSink receives the jobs that failed after exhausting their retries
+type DeadLetterSink[In any] interface {
+	Put(ctx context.Context, letter DeadLetter[In]) error
+}
+
+// MemoryDeadLetters keeps the dead letters in memory, mostly useful for tests
+type MemoryDeadLetters[In any] struct {
+	mu      sync.Mutex
+	letters []DeadLetter[In]
+}
+
+// Put implements DeadLetterSink
+func (m *MemoryDeadLetters[In]) Put(_ context.Context, letter DeadLetter[In]) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.letters = append(m.letters, letter)
+	return nil
+}
+
+// Letters returns a copy of the dead letters received so far
+func (m *MemoryDeadLetters[In]) Letters() []DeadLetter[In] {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]DeadLetter[In](nil), m.letters...)
+}
+
+// FileDeadLetters appends the dead letters to a file, one JSON object per line
+type FileDeadLetters[In any] struct {
+	mu   sync.Mutex
+	file *os.File
+	enc  *json.Encoder
+}
+
+// deadLetterRecord is the JSON form of a dead letter, errors are kept as messages
+type deadLetterRecord[In any] struct {
+	Input    In        `json:"input"`
+	Errors   []string  `json:"errors"`
+	Attempts int       `json:"attempts"`
+	FailedAt time.Time `json:"failed_at"`
+}
+
+// NewFileDeadLetters opens, or creates, the JSON lines file at path in append mode
+func NewFileDeadLetters[In any](path string) (*FileDeadLetters[In], error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("workerpool: open dead letter file: %w", err)
+	}
+
+	return &FileDeadLetters[In]{file: file, enc: json.NewEncoder(file)}, nil
+}
+
+// Put implements DeadLetterSink
+func (f *FileDeadLetters[In]) Put(_ context.Context, letter DeadLetter[In]) error {
+	record := deadLetterRecord[In]{
+		Input:    letter.Input,
+		Errors:   make([]string, len(letter.Errors)),
+		Attempts: letter.Attempts(),
+		FailedAt: letter.FailedAt,
+	}
+	for i, err := range letter.Errors {
+		record.Errors[i] = err.Error()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.enc.Encode(record); err != nil {
+		return fmt.Errorf("workerpool: write dead letter: %w", err)
+	}
+	return nil
+}
+
+// Close closes the underlying file
+func (f *FileDeadLetters[In]) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.file.Close()
+}
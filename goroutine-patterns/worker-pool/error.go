@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrPoolClosed is returned by Submit once the pool has been shut down
+	ErrPoolClosed = errors.New("workerpool: pool is closed")
+
+	// ErrQueueFull is returned by Submit when the queue is full and the overflow policy is Reject
+	ErrQueueFull = errors.New("workerpool: queue is full")
+
+	// ErrJobDropped is returned by Submit when the job was evicted by the DropOldest policy
+	ErrJobDropped = errors.New("workerpool: job dropped from a full queue")
+
+	// ErrInvalidSize is returned by Resize when asked for less than one worker
+	ErrInvalidSize = errors.New("workerpool: pool size must be at least 1")
+
+	// ErrKeyedResize is returned by Resize on a pool dispatching jobs by key
+	ErrKeyedResize = errors.New("workerpool: a keyed pool cannot be resized")
+
+	// ErrNoKeyRateLimit is returned by SetKeyRateLimit on a pool created without WithKeyRateLimit
+	ErrNoKeyRateLimit = errors.New("workerpool: no per-key rate limit configured")
+
+	// errRunInCaller tells Submit to process the job itself under the CallerRuns policy
+	errRunInCaller = errors.New("workerpool: run in caller")
+)
+
+// PanicError is returned by Submit when the processor panicked while handling a job.
+// The panic is recovered inside the worker so the rest of the pool keeps running.
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("workerpool: job panicked: %v", e.Value)
+}
+
+// Unwrap exposes the panic value when it is an error, so errors.Is/As keep working
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
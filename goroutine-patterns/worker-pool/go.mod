@@ -2,4 +2,6 @@ module workerpool
 
 go 1.24.5
 
-require golang.org/x/sync v0.19.0 // indirect
+require future v0.0.0-00010101000000-000000000000
+
+replace future => ../future
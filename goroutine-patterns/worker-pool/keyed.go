@@ -0,0 +1,86 @@
+package main
+
+import (
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+// ringReplicas is the number of points each shard owns on the hash ring
+const ringReplicas = 64
+
+// hashRing maps keys to shards with consistent hashing
+type hashRing struct {
+	points []uint32 // sorted hashes of the virtual nodes
+	owners []int    // owners[i] is the shard of points[i]
+}
+
+// newHashRing builds a ring spreading ringReplicas virtual nodes per shard
+func newHashRing(shards int) *hashRing {
+	type node struct {
+		point uint32
+		shard int
+	}
+
+	nodes := make([]node, 0, shards*ringReplicas)
+	for shard := 0; shard < shards; shard++ {
+		for replica := 0; replica < ringReplicas; replica++ {
+			nodes = append(nodes, node{
+				point: hashKey(strconv.Itoa(shard) + "#" + strconv.Itoa(replica)),
+				shard: shard,
+			})
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].point < nodes[j].point })
+
+	r := &hashRing{
+		points: make([]uint32, len(nodes)),
+		owners: make([]int, len(nodes)),
+	}
+	for i, n := range nodes {
+		r.points[i] = n.point
+		r.owners[i] = n.shard
+	}
+
+	return r
+}
+
+// shard returns the shard owning the first virtual node at or after the hash of key
+func (r *hashRing) shard(key string) int {
+	h := hashKey(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.owners[i]
+}
+
+// hashKey hashes a key with FNV-1a
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// keyed reports whether the jobs are dispatched by key
+func (p *WorkerPool[In, Out]) keyed() bool {
+	return p.keyOf != nil
+}
+
+// queueFor returns the channel a job is sent to: the shard of its key in keyed mode,
+// the lane of its priority otherwise
+func (p *WorkerPool[In, Out]) queueFor(job Job[In, Out]) chan Job[In, Out] {
+	if p.keyed() {
+		return p.shards[p.ring.shard(p.keyOf(job.Input))]
+	}
+
+	return p.lanes[job.Priority]
+}
+
+// nextKeyed returns the next job of the shard owned by the worker, or false once
+// the shard is closed and drained
+func (p *WorkerPool[In, Out]) nextKeyed(w *worker) (Job[In, Out], bool) {
+	job, ok := <-p.shards[w.shard]
+	return job, ok
+}
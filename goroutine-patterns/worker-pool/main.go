@@ -2,107 +2,196 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 )
 
-// Job represents a unit of work with input and output types
-type Job[In, Out any] struct {
-	Input  In
-	Result chan Out
-}
+func main() {
+	// Example usage of the WorkerPool
+	pool := NewWorkerPool(5, func(ctx context.Context, x int) (int, error) {
+		time.Sleep(100 * time.Millisecond) // Simulate work
+		switch x {
+		case 3:
+			return 0, fmt.Errorf("error processing item %d", x)
+		case 7:
+			// A panicking job is isolated and reported as a *PanicError
+			var m map[int]int
+			m[x] = x
+		}
+		return x * 2, nil
+	}, WithQueueSize[int](5), WithObserver[int](logObserver{}))
 
-// WorkerPool manages a pool of workers processing jobs concurrently
-type WorkerPool[In, Out any] struct {
-	workers   int
-	jobs      chan Job[In, Out]
-	done      chan struct{}
-	processor func(In) Out
-}
+	pool.Start()
+
+	// Process multiple items concurrently, results come back in input order
+	inputs := make([]int, 10)
+	for i := range inputs {
+		inputs[i] = i
+	}
+	results, errs := pool.SubmitBatch(context.Background(), inputs)
 
-// NewWorkerPool creates a new WorkerPool with the specified number of workers and processing function
-func NewWorkerPool[In, Out any](workers int, processor func(In) Out) *WorkerPool[In, Out] {
-	return &WorkerPool[In, Out]{
-		workers:   workers,
-		jobs:      make(chan Job[In, Out]),
-		done:      make(chan struct{}),
-		processor: processor,
+	// Stream inputs through the pool and read the results as they complete
+	stream := make(chan int)
+	go func() {
+		defer close(stream)
+		for i := 10; i < 15; i++ {
+			stream <- i
+		}
+	}()
+	for result := range pool.Stream(context.Background(), stream, StreamOrdered()) {
+		fmt.Printf("Streamed #%d: %d (err: %v)\n", result.Index, result.Value, result.Err)
+	}
+
+	// Stop the pool: no new job is accepted and the workers exit once drained
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := pool.Shutdown(shutdownCtx); err != nil {
+		fmt.Println("Shutdown did not complete:", err)
+	}
+	if _, err := pool.Submit(context.Background(), 42); errors.Is(err, ErrPoolClosed) {
+		fmt.Println("Submit after shutdown:", err)
+	}
+
+	stats := pool.Stats()
+	fmt.Printf("Stats: completed=%d failed=%d rejected=%d latency=%v\n",
+		stats.Completed, stats.Failed, stats.Rejected, stats.Latency.Counts)
+
+	fmt.Println("Results:", results)
+	for i, res := range results {
+		var panicErr *PanicError
+		switch {
+		case errors.As(errs[i], &panicErr):
+			fmt.Printf("Input: %d, Panic: %v\n", i, panicErr.Value)
+		case errs[i] != nil:
+			fmt.Printf("Input: %d, Error: %v\n", i, errs[i])
+		default:
+			fmt.Printf("Input: %d, Output: %d\n", i, res)
+		}
 	}
+
+	loadShedding()
+	autoscaling()
+	priorities()
+	keyedDispatch()
 }
 
-// Start initializes the worker pool and begins processing jobs
-func (p *WorkerPool[In, Out]) Start() {
-	for i := 0; i < p.workers; i++ {
-		// Launch each worker as a separate goroutine
-		go func(workerID int) {
-			// Auto dispatch pattern to workers
-			// Each Goroutine continuously listens for the same jobs channel
-			for job := range p.jobs {
-				fmt.Printf("Worker %d processing input: %v\n", workerID, job.Input)
-
-				results := p.processor(job.Input)
-				job.Result <- results
-				close(job.Result)
+// logObserver prints the jobs as the workers pick them up
+type logObserver struct{}
+
+func (logObserver) OnEnqueue(JobEvent) {}
+
+func (logObserver) OnStart(e JobEvent) {
+	fmt.Printf("Worker %d processing input: %v\n", e.WorkerID, e.Input)
+}
+
+func (logObserver) OnFinish(e JobEvent) {}
+
+// loadShedding shows a pool that rejects jobs instead of piling them up when it is saturated
+func loadShedding() {
+	pool := NewWorkerPool(1, func(ctx context.Context, x int) (int, error) {
+		time.Sleep(100 * time.Millisecond) // Simulate a slow downstream
+		return x, nil
+	}, WithQueueSize[int](2), WithOverflowPolicy[int](Reject), WithObserver[int](logObserver{}))
+
+	pool.Start()
+	defer pool.ShutdownNow()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			if _, err := pool.Submit(context.Background(), i); errors.Is(err, ErrQueueFull) {
+				fmt.Printf("Input %d rejected: %v\n", i, err)
 			}
 		}(i)
 	}
+	wg.Wait()
 }
 
-// Submit adds a job to the worker pool and returns the result
-func (p *WorkerPool[In, Out]) Submit(ctx context.Context, input In) (Out, error) {
-	resultChan := make(chan Out)
-	select {
-	// Submit the job to the jobs channel
-	case p.jobs <- Job[In, Out]{Input: input, Result: resultChan}:
-		select {
-		// Wait for the result or context cancellation
-		case result := <-resultChan:
-			return result, nil
-		// Handle context cancellation while waiting for the result
-		case <-ctx.Done():
-			return *new(Out), ctx.Err()
-		}
-	// Handle context cancellation while submitting the job
-	case <-ctx.Done():
-		return *new(Out), ctx.Err()
+// autoscaling shows a pool growing under a burst of jobs and shrinking back once idle
+func autoscaling() {
+	pool := NewWorkerPool(1, func(ctx context.Context, x int) (int, error) {
+		time.Sleep(50 * time.Millisecond) // Simulate work
+		return x, nil
+	}, WithQueueSize[int](100), WithAutoscaler[int](AutoscaleConfig{Min: 1, Max: 8, Interval: 100 * time.Millisecond}))
+
+	pool.Start()
+	defer pool.ShutdownNow()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _ = pool.Submit(context.Background(), i)
+		}(i)
+	}
+
+	for i := 0; i < 10; i++ {
+		time.Sleep(100 * time.Millisecond)
+		fmt.Printf("Autoscaler: %d workers\n", pool.Size())
 	}
+	wg.Wait()
 }
 
-func main() {
-	// Example usage of the WorkerPool
-	pool := NewWorkerPool(5, func(x int) int {
-		time.Sleep(100 * time.Millisecond) // Simulate work
-		return x * 2
-	})
+// priorities shows high priority jobs overtaking a backlog of bulk jobs
+func priorities() {
+	pool := NewWorkerPool(1, func(ctx context.Context, x string) (string, error) {
+		time.Sleep(10 * time.Millisecond) // Simulate work
+		return x, nil
+	}, WithQueueSize[string](20), WithObserver[string](logObserver{}))
 
 	pool.Start()
-
-	// Process multiple items concurrently
-	results := make([]int, 10)
+	defer pool.ShutdownNow()
 
 	var wg sync.WaitGroup
+	submit := func(input string, priority Priority) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = pool.SubmitWithPriority(context.Background(), input, priority)
+		}()
+	}
 
-	// Submit jobs to the worker pool
 	for i := 0; i < 10; i++ {
+		submit(fmt.Sprintf("bulk-%d", i), PriorityLow)
+	}
+	time.Sleep(20 * time.Millisecond)
+	submit("urgent", PriorityHigh)
+
+	wg.Wait()
+}
+
+// Event is an update to apply to an account
+type Event struct {
+	Account string
+	Seq     int
+}
+
+// keyedDispatch shows jobs of the same account running one at a time on the same worker
+func keyedDispatch() {
+	pool := NewWorkerPool(3, func(ctx context.Context, e Event) (string, error) {
+		time.Sleep(10 * time.Millisecond) // Simulate work
+		return fmt.Sprintf("%s#%d", e.Account, e.Seq), nil
+	}, WithQueueSize[Event](10), WithKeyFunc(func(e Event) string { return e.Account }), WithObserver[Event](logObserver{}))
+
+	pool.Start()
+	defer pool.ShutdownNow()
+
+	var wg sync.WaitGroup
+	for _, account := range []string{"alice", "bob", "carol", "dave"} {
 		wg.Add(1)
-		go func(i int) {
+		go func(account string) {
 			defer wg.Done()
 
-			ctx := context.Background()
-			result, err := pool.Submit(ctx, i)
-			if err != nil {
-				fmt.Printf("Error processing %d: %v\n", i, err)
-
-				return
+			for seq := 0; seq < 3; seq++ {
+				_, _ = pool.Submit(context.Background(), Event{Account: account, Seq: seq})
 			}
-			results[i] = result
-		}(i)
+		}(account)
 	}
-
 	wg.Wait()
-	fmt.Println("Results:", results)
-	for i, res := range results {
-		fmt.Printf("Input: %d, Output: %d\n", i, res)
-	}
 }
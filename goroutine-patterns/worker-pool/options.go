@@ -0,0 +1,194 @@
+package main
+
+import "time"
+
+// OverflowPolicy decides what Submit does when the job queue is full
+type OverflowPolicy int
+
+const (
+	// Block makes Submit wait until the queue has room, the context is done or the pool is closed
+	Block OverflowPolicy = iota
+	// Reject makes Submit fail immediately with ErrQueueFull
+	Reject
+	// DropOldest evicts the oldest queued job, which fails with ErrJobDropped, to make room
+	DropOldest
+	// CallerRuns processes the job in the goroutine calling Submit
+	CallerRuns
+)
+
+// String returns the name of the policy
+func (o OverflowPolicy) String() string {
+	switch o {
+	case Block:
+		return "block"
+	case Reject:
+		return "reject"
+	case DropOldest:
+		return "drop-oldest"
+	case CallerRuns:
+		return "caller-runs"
+	default:
+		return "unknown"
+	}
+}
+
+// options holds the optional settings of a WorkerPool of inputs In
+type options[In any] struct {
+	queueSize   int
+	overflow    OverflowPolicy
+	autoscale   *AutoscaleConfig
+	aging       int
+	observer    Observer
+	jobTimeout  time.Duration
+	keyFunc     func(In) string
+	rate        float64
+	burst       int
+	keyLimit    keyRateLimit[In]
+	retry       RetryPolicy
+	deadLetters DeadLetterSink[In]
+	queue       Queue[In]
+}
+
+// keyRateLimit holds the settings of WithKeyRateLimit
+type keyRateLimit[In any] struct {
+	keyFunc func(In) string
+	rate    float64
+	burst   int
+}
+
+// Option configures a WorkerPool of inputs In created by NewWorkerPool. Being typed
+// by the input, an option built for another input type does not compile.
+type Option[In any] func(*options[In])
+
+// defaultOptions keeps the historical behaviour: an unbuffered queue where Submit blocks
+func defaultOptions[In any]() options[In] {
+	return options[In]{
+		queueSize: 0,
+		overflow:  Block,
+		aging:     10,
+		observer:  nopObserver{},
+		retry:     RetryPolicy{MaxAttempts: 1},
+		queue:     &memoryQueue[In]{},
+	}
+}
+
+// WithQueueSize sets how many jobs can wait for a free worker in each priority lane.
+// With the default size of 0 a job is only accepted when a worker is ready to take it.
+func WithQueueSize[In any](size int) Option[In] {
+	return func(o *options[In]) {
+		if size > 0 {
+			o.queueSize = size
+		}
+	}
+}
+
+// WithOverflowPolicy sets the behaviour of Submit when the queue is full
+func WithOverflowPolicy[In any](policy OverflowPolicy) Option[In] {
+	return func(o *options[In]) {
+		o.overflow = policy
+	}
+}
+
+// WithAutoscaler lets the pool resize itself between cfg.Min and cfg.Max workers
+// from the queue depth and the job latency, see AutoscaleConfig
+func WithAutoscaler[In any](cfg AutoscaleConfig) Option[In] {
+	return func(o *options[In]) {
+		cfg.Min = max(cfg.Min, 1)
+		cfg.Max = max(cfg.Max, cfg.Min)
+		if cfg.Interval <= 0 {
+			cfg.Interval = time.Second
+		}
+		o.autoscale = &cfg
+	}
+}
+
+// WithAging sets after how many jobs dispatched ahead of it a waiting lower
+// priority lane is served first, so that low priority jobs still make progress.
+// The default is 10.
+func WithAging[In any](skips int) Option[In] {
+	return func(o *options[In]) {
+		if skips > 0 {
+			o.aging = skips
+		}
+	}
+}
+
+// WithObserver registers an observer notified when jobs are enqueued, started and finished
+func WithObserver[In any](observer Observer) Option[In] {
+	return func(o *options[In]) {
+		if observer != nil {
+			o.observer = observer
+		}
+	}
+}
+
+// WithJobTimeout bounds the processing time of every job. The processor gets a
+// context that expires after the timeout, on top of the deadline of the submitter.
+func WithJobTimeout[In any](timeout time.Duration) Option[In] {
+	return func(o *options[In]) {
+		if timeout > 0 {
+			o.jobTimeout = timeout
+		}
+	}
+}
+
+// WithKeyFunc dispatches the jobs by key: every job is routed to the worker owning
+// its key on a consistent hash ring, so that jobs sharing a key run one at a time
+// in submission order while different keys still run in parallel.
+// In keyed mode priorities are ignored, CallerRuns blocks instead and the pool
+// cannot be resized.
+func WithKeyFunc[In any](fn func(In) string) Option[In] {
+	return func(o *options[In]) {
+		if fn != nil {
+			o.keyFunc = fn
+		}
+	}
+}
+
+// WithRateLimit makes Submit wait for a token from a bucket refilled at rate
+// tokens per second, holding up to burst tokens. See SetRateLimit to change it at runtime.
+func WithRateLimit[In any](rate float64, burst int) Option[In] {
+	return func(o *options[In]) {
+		o.rate, o.burst = rate, burst
+	}
+}
+
+// WithKeyRateLimit adds a token bucket per key, on top of the global rate limit
+func WithKeyRateLimit[In any](fn func(In) string, rate float64, burst int) Option[In] {
+	return func(o *options[In]) {
+		if fn != nil {
+			o.keyLimit = keyRateLimit[In]{keyFunc: fn, rate: rate, burst: burst}
+		}
+	}
+}
+
+// WithRetry retries the failed jobs according to the policy. The worker waits
+// for the backoff between two attempts, so a retried job keeps its worker busy.
+func WithRetry[In any](policy RetryPolicy) Option[In] {
+	return func(o *options[In]) {
+		policy.MaxAttempts = max(policy.MaxAttempts, 1)
+		o.retry = policy
+	}
+}
+
+// WithDeadLetter hands the jobs that failed for good, after their retries, to sink.
+// An error of the sink is joined to the error returned by Submit.
+func WithDeadLetter[In any](sink DeadLetterSink[In]) Option[In] {
+	return func(o *options[In]) {
+		if sink != nil {
+			o.deadLetters = sink
+		}
+	}
+}
+
+// WithQueue records the accepted jobs in q until they are settled, so that a
+// durable queue such as WALQueue replays on Start the jobs a crash interrupted.
+// A job is acknowledged once it succeeded, was taken by the dead letter sink, or
+// was refused or abandoned before running; a failed job is replayed on the next run.
+func WithQueue[In any](q Queue[In]) Option[In] {
+	return func(o *options[In]) {
+		if q != nil {
+			o.queue = q
+		}
+	}
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Processor is the function run by the workers for every submitted input
+type Processor[In, Out any] func(context.Context, In) (Out, error)
+
+// Result carries the output of a job together with its error
+type Result[Out any] struct {
+	// Index is the position of the input in the stream, only set by Stream
+	Index int
+	Value Out
+	Err   error
+}
+
+// Job represents a unit of work with input and output types
+type Job[In, Out any] struct {
+	// Ctx is the context of the submitter, passed on to the processor
+	Ctx      context.Context
+	Input    In
+	Priority Priority
+	// Result is buffered so that a job can be answered without waiting for its submitter
+	Result chan Result[Out]
+
+	queuedAt time.Time
+	id       uint64    // id of the input in the Queue of the pool
+	state    *jobState // status of a job submitted with SubmitAsync
+}
+
+// reply delivers the result of the job to its submitter
+func (j Job[In, Out]) reply(result Result[Out]) {
+	j.Result <- result
+	close(j.Result)
+}
+
+// WorkerPool manages a pool of workers processing jobs concurrently
+type WorkerPool[In, Out any] struct {
+	// lanes holds one job queue per priority, see SubmitWithPriority
+	lanes [numPriorities]chan Job[In, Out]
+	// shards holds one job queue per worker in keyed mode, see WithKeyFunc
+	shards []chan Job[In, Out]
+	ring   *hashRing
+	keyOf  func(In) string
+
+	// limiter and keyLimiter throttle Submit, see WithRateLimit and WithKeyRateLimit
+	limiter    *TokenBucket
+	keyLimiter *keyedLimiter
+	limitKeyOf func(In) string
+
+	// deadLetters receives the jobs that failed for good, see WithDeadLetter
+	deadLetters DeadLetterSink[In]
+	// queue records the accepted jobs until they are settled, see WithQueue
+	queue Queue[In]
+	// scheduler holds the delayed and recurring jobs, see SubmitAt and Schedule
+	scheduler *scheduler
+	// futures indexes the pending jobs of SubmitAsync by id, see Cancel
+	futures sync.Map
+
+	processor Processor[In, Out]
+	opts      options[In]
+
+	// ctx is cancelled by ShutdownNow to abort the running jobs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu is held for reading while a job is sent so that the lanes are never closed
+	// under a pending Submit
+	mu sync.RWMutex
+	// wmu guards the worker set and started, so that Start and Resize never wait behind
+	// a blocked Submit. closed is written with both locks held and can be read under either.
+	wmu     sync.Mutex
+	started bool
+	closed  bool
+	size    int       // number of workers the pool should run
+	workers []*worker // running workers, see Resize
+	nextID  int
+
+	// waiting counts the Submit calls blocked on a full lane
+	waiting [numPriorities]atomic.Int64
+	// starved counts how many jobs were dispatched ahead of a non-empty lane
+	starved [numPriorities]atomic.Int64
+	// latency accumulates the processing time of the jobs, read by the autoscaler
+	latency latencyWindow
+	stats   poolStats
+
+	quit      chan struct{} // closed when the shutdown begins
+	done      chan struct{} // closed when every worker has exited
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+// NewWorkerPool creates a new WorkerPool with the specified number of workers and processing function
+func NewWorkerPool[In, Out any](workers int, processor Processor[In, Out], opts ...Option[In]) *WorkerPool[In, Out] {
+	o := defaultOptions[In]()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &WorkerPool[In, Out]{
+		size:      workers,
+		processor: processor,
+		opts:      o,
+		ctx:       ctx,
+		cancel:    cancel,
+		quit:      make(chan struct{}),
+		done:      make(chan struct{}),
+		limiter:   NewTokenBucket(o.rate, o.burst),
+
+		deadLetters: o.deadLetters,
+		queue:       o.queue,
+		scheduler:   newScheduler(),
+	}
+	for i := range p.lanes {
+		p.lanes[i] = make(chan Job[In, Out], o.queueSize)
+	}
+
+	// In keyed mode each worker owns a shard, so that jobs sharing a key run in order
+	if p.keyOf = o.keyFunc; p.keyOf != nil {
+		p.size = max(workers, 1)
+		p.shards = make([]chan Job[In, Out], p.size)
+		for i := range p.shards {
+			p.shards[i] = make(chan Job[In, Out], o.queueSize)
+		}
+		p.ring = newHashRing(p.size)
+	}
+
+	if p.limitKeyOf = o.keyLimit.keyFunc; p.limitKeyOf != nil {
+		p.keyLimiter = newKeyedLimiter(o.keyLimit.rate, o.keyLimit.burst)
+	}
+
+	return p
+}
+
+// Start initializes the worker pool and begins processing jobs.
+// Calling Start more than once, or after a shutdown, has no effect.
+func (p *WorkerPool[In, Out]) Start() {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	if p.started || p.closed {
+		return
+	}
+	p.started = true
+
+	if cfg := p.opts.autoscale; cfg != nil && !p.keyed() {
+		p.size = min(max(p.size, cfg.Min), cfg.Max)
+	}
+
+	for i := 0; i < p.size; i++ {
+		p.spawn()
+	}
+
+	go func() {
+		p.wg.Wait()
+		close(p.done)
+	}()
+
+	if p.opts.autoscale != nil && !p.keyed() {
+		go p.autoscale(*p.opts.autoscale)
+	}
+
+	// Feed the jobs left pending by a previous run
+	go p.replay()
+}
+
+// spawn launches a new worker goroutine. It must be called with p.wmu held.
+func (p *WorkerPool[In, Out]) spawn() {
+	w := &worker{id: p.nextID, retire: make(chan struct{}), shard: -1}
+	if p.keyed() {
+		w.shard = p.nextID
+	}
+	p.nextID++
+	p.workers = append(p.workers, w)
+
+	p.wg.Add(1)
+	// Launch each worker as a separate goroutine
+	go p.work(w)
+}
+
+// work is the loop run by each worker goroutine
+func (p *WorkerPool[In, Out]) work(w *worker) {
+	defer p.wg.Done()
+
+	// Auto dispatch pattern to workers
+	// Each Goroutine continuously listens for the same lanes
+	// until they are closed by the shutdown or the worker is retired by Resize
+	lanes := p.lanes
+	for {
+		var (
+			job Job[In, Out]
+			ok  bool
+		)
+		if p.keyed() {
+			job, ok = p.nextKeyed(w)
+		} else {
+			job, ok = p.next(w, &lanes)
+		}
+		if !ok {
+			return
+		}
+
+		// Jobs still waiting after ShutdownNow are discarded
+		if p.ctx.Err() != nil {
+			p.stats.rejected.Add(1)
+			job.reply(Result[Out]{Err: ErrPoolClosed})
+			continue
+		}
+
+		// Jobs abandoned by their submitter while queued are not processed
+		if err := job.Ctx.Err(); err != nil {
+			p.stats.cancelled.Add(1)
+			p.ack(job)
+			job.reply(Result[Out]{Err: err})
+			continue
+		}
+
+		value, err := p.execute(w, job)
+		job.reply(Result[Out]{Value: value, Err: err})
+	}
+}
+
+// execute runs a job on behalf of a worker, or of the caller when w is nil,
+// retries it according to the retry policy, hands it to the dead letter sink
+// if it failed for good, and records it in the stats and the observer
+func (p *WorkerPool[In, Out]) execute(w *worker, job Job[In, Out]) (Out, error) {
+	event := JobEvent{
+		WorkerID: -1,
+		Priority: job.Priority,
+		Input:    job.Input,
+		Waited:   time.Since(job.queuedAt),
+	}
+	if w != nil {
+		event.WorkerID = w.id
+		w.busy.Store(true)
+		defer w.busy.Store(false)
+	}
+
+	if job.state != nil {
+		job.state.status.CompareAndSwap(int32(JobQueued), int32(JobRunning))
+	}
+
+	p.stats.running.Add(1)
+	defer p.stats.running.Add(-1)
+
+	var (
+		value   Out
+		err     error
+		history []error
+	)
+	for attempt := 1; ; attempt++ {
+		event.Attempt = attempt
+		event.Duration, event.Err = 0, nil
+		p.opts.observer.OnStart(event)
+
+		start := time.Now()
+		value, err = p.run(job)
+		elapsed := time.Since(start)
+
+		p.stats.observe(elapsed)
+		p.latency.observe(elapsed)
+		if w != nil {
+			w.busyTime.Add(int64(elapsed))
+		}
+
+		event.Duration, event.Err = elapsed, err
+		p.opts.observer.OnFinish(event)
+
+		if err == nil {
+			break
+		}
+		history = append(history, err)
+
+		retry := p.opts.retry
+		if attempt >= retry.MaxAttempts || !p.retryable(job, err) || !p.sleep(job, retry.backoff(attempt)) {
+			break
+		}
+		p.stats.retried.Add(1)
+	}
+
+	if w != nil {
+		w.jobs.Add(1)
+	}
+	if err == nil {
+		p.stats.completed.Add(1)
+		p.ack(job)
+		return value, nil
+	}
+	p.stats.failed.Add(1)
+
+	// Cancelled jobs were given up by their submitter or the pool, they are not dead letters.
+	// A failed job stays in the queue, unless the dead letter sink took it over.
+	if p.deadLetters != nil && job.Ctx.Err() == nil && p.ctx.Err() == nil {
+		letter := DeadLetter[In]{Input: job.Input, Errors: history, FailedAt: time.Now()}
+		if sinkErr := p.deadLetters.Put(job.Ctx, letter); sinkErr != nil {
+			err = errors.Join(err, sinkErr)
+		} else {
+			p.ack(job)
+		}
+	}
+
+	return value, err
+}
+
+// run executes a job with the context of its submitter, bounded by the job timeout
+// of the pool and also cancelled by ShutdownNow
+func (p *WorkerPool[In, Out]) run(job Job[In, Out]) (Out, error) {
+	ctx, cancel := context.WithCancel(job.Ctx)
+	defer cancel()
+
+	if p.opts.jobTimeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, p.opts.jobTimeout)
+		defer cancelTimeout()
+	}
+
+	stop := context.AfterFunc(p.ctx, cancel)
+	defer stop()
+
+	return p.process(ctx, job.Input)
+}
+
+// process runs the processor for a single input and turns a panic into a *PanicError,
+// so one bad input never takes the whole pool down
+func (p *WorkerPool[In, Out]) process(ctx context.Context, input In) (value Out, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value = *new(Out)
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	return p.processor(ctx, input)
+}
+
+// Submit adds a job with PriorityNormal to the worker pool and returns the result or the error of the job.
+// When the queue is full the outcome depends on the overflow policy of the pool.
+// It returns ErrPoolClosed once a shutdown has started.
+func (p *WorkerPool[In, Out]) Submit(ctx context.Context, input In) (Out, error) {
+	return p.SubmitWithPriority(ctx, input, PriorityNormal)
+}
+
+// SubmitWithPriority is like Submit but queues the job in the lane of the given priority.
+// Higher priorities are dispatched first, see WithAging for the starvation protection.
+// With a rate limit, it first waits for a token as long as ctx allows.
+func (p *WorkerPool[In, Out]) SubmitWithPriority(ctx context.Context, input In, priority Priority) (Out, error) {
+	job := Job[In, Out]{
+		Ctx:      ctx,
+		Input:    input,
+		Priority: priority.clamp(),
+		Result:   make(chan Result[Out], 1),
+	}
+
+	err := p.submit(&job)
+	switch {
+	case errors.Is(err, errRunInCaller):
+		return p.execute(nil, job)
+	case err != nil:
+		return *new(Out), err
+	}
+
+	select {
+	// Wait for the result or context cancellation
+	case result := <-job.Result:
+		return result.Value, result.Err
+	// Handle context cancellation while waiting for the result
+	case <-ctx.Done():
+		return *new(Out), ctx.Err()
+	}
+}
+
+// submit waits for the rate limits, records the job in the queue and puts it in
+// its lane. It returns errRunInCaller when the caller has to run the job itself.
+func (p *WorkerPool[In, Out]) submit(job *Job[In, Out]) error {
+	// Wait for the rate limits before queuing the job
+	if err := p.wait(*job); err != nil {
+		return err
+	}
+
+	// Record the job before queuing it, so that it survives a restart
+	id, err := p.queue.Push(job.Input)
+	if err != nil {
+		return err
+	}
+	job.id = id
+	job.queuedAt = time.Now()
+
+	p.mu.RLock()
+	err = p.enqueue(*job)
+	p.mu.RUnlock()
+
+	switch {
+	case errors.Is(err, errRunInCaller):
+		return err
+	case errors.Is(err, ErrQueueFull), errors.Is(err, ErrPoolClosed):
+		p.stats.rejected.Add(1)
+		p.ack(*job)
+		return err
+	case err != nil:
+		p.ack(*job)
+		return err
+	}
+
+	p.opts.observer.OnEnqueue(JobEvent{WorkerID: -1, Priority: job.Priority, Input: job.Input})
+	return nil
+}
+
+// enqueue puts the job in its lane, or its shard in keyed mode, according to the
+// overflow policy. It must be called with p.mu held for reading.
+func (p *WorkerPool[In, Out]) enqueue(job Job[In, Out]) error {
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	lane := p.queueFor(job)
+
+	// Fast path: there is room in the lane or an idle worker
+	select {
+	case lane <- job:
+		return nil
+	default:
+	}
+
+	switch p.opts.overflow {
+	case Reject:
+		return ErrQueueFull
+	case CallerRuns:
+		// Running in the caller would overtake the jobs of the same key
+		if !p.keyed() {
+			return errRunInCaller
+		}
+	case DropOldest:
+		// Only a buffered lane has an oldest job to evict
+		var oldest <-chan Job[In, Out]
+		if cap(lane) > 0 {
+			oldest = lane
+		}
+
+		p.waiting[job.Priority].Add(1)
+		defer p.waiting[job.Priority].Add(-1)
+
+		for {
+			select {
+			case lane <- job:
+				return nil
+			default:
+			}
+
+			// The lane is full: evict the oldest job, unless a slot frees up meanwhile
+			select {
+			case lane <- job:
+				return nil
+			case evicted := <-oldest:
+				p.stats.rejected.Add(1)
+				p.ack(evicted)
+				evicted.reply(Result[Out]{Err: ErrJobDropped})
+			case <-job.Ctx.Done():
+				return job.Ctx.Err()
+			case <-p.quit:
+				return ErrPoolClosed
+			}
+		}
+	}
+
+	return p.enqueueBlocking(job)
+}
+
+// enqueueBlocking waits for room in the lane, or the shard, of the job.
+// It must be called with p.mu held for reading.
+func (p *WorkerPool[In, Out]) enqueueBlocking(job Job[In, Out]) error {
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	lane := p.queueFor(job)
+
+	p.waiting[job.Priority].Add(1)
+	defer p.waiting[job.Priority].Add(-1)
+
+	select {
+	// Submit the job to its lane
+	case lane <- job:
+		return nil
+	// Handle context cancellation while submitting the job
+	case <-job.Ctx.Done():
+		return job.Ctx.Err()
+	// Stop accepting jobs as soon as the shutdown begins
+	case <-p.quit:
+		return ErrPoolClosed
+	}
+}
+
+// Shutdown stops accepting new jobs and waits for the in-flight jobs to finish.
+// It returns nil once every worker has exited, or the context error if ctx expires first.
+func (p *WorkerPool[In, Out]) Shutdown(ctx context.Context) error {
+	p.close()
+
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// ShutdownNow stops accepting new jobs, cancels the context of the running jobs,
+// discards the pending ones and waits for the workers to exit.
+// A processor that ignores its context delays ShutdownNow until it returns.
+func (p *WorkerPool[In, Out]) ShutdownNow() {
+	p.cancel()
+	p.close()
+	<-p.done
+}
+
+// close stops the intake of jobs and lets the workers drain the lanes
+func (p *WorkerPool[In, Out]) close() {
+	p.closeOnce.Do(func() {
+		// Unblock the Submit calls waiting to send before taking the write lock
+		close(p.quit)
+
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		p.wmu.Lock()
+		defer p.wmu.Unlock()
+
+		p.closed = true
+		for _, lane := range p.lanes {
+			close(lane)
+		}
+		for _, shard := range p.shards {
+			close(shard)
+		}
+
+		// Without workers there is nothing to wait for, but the jobs queued
+		// before Start still wait for a reply
+		if !p.started {
+			p.discard()
+			close(p.done)
+		}
+	})
+}
+
+// discard replies ErrPoolClosed to the jobs left in the closed lanes and shards
+// of a pool that was never started
+func (p *WorkerPool[In, Out]) discard() {
+	queues := append(p.lanes[:], p.shards...)
+	for _, queue := range queues {
+		for job := range queue {
+			p.stats.rejected.Add(1)
+			p.ack(job)
+			job.reply(Result[Out]{Err: ErrPoolClosed})
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+// Priority selects the lane of a job, higher priorities are dispatched first
+type Priority int
+
+const (
+	PriorityLow Priority = iota
+	PriorityNormal
+	PriorityHigh
+
+	numPriorities = int(PriorityHigh) + 1
+)
+
+// String returns the name of the priority
+func (pr Priority) String() string {
+	switch pr {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return "unknown"
+	}
+}
+
+// clamp brings an out of range priority back to the closest lane
+func (pr Priority) clamp() Priority {
+	return min(max(pr, PriorityLow), PriorityHigh)
+}
+
+// next returns the next job for the worker, or false once the worker is retired
+// or every lane is closed and drained. lanes is the worker's own view of the lanes,
+// where a closed lane is replaced by nil so that it is no longer selected.
+func (p *WorkerPool[In, Out]) next(w *worker, lanes *[numPriorities]chan Job[In, Out]) (Job[In, Out], bool) {
+	for {
+		select {
+		case <-w.retire:
+			return Job[In, Out]{}, false
+		default:
+		}
+
+		// Take the first ready job in dispatch order
+		for _, prio := range p.dispatchOrder() {
+			if lanes[prio] == nil {
+				continue
+			}
+
+			select {
+			case job, ok := <-lanes[prio]:
+				if !ok {
+					lanes[prio] = nil
+					continue
+				}
+				p.dispatched(prio)
+				return job, true
+			default:
+			}
+		}
+		if *lanes == [numPriorities]chan Job[In, Out]{} {
+			return Job[In, Out]{}, false
+		}
+
+		// Nothing is ready: wait for a job on any lane
+		var (
+			job Job[In, Out]
+			ok  bool
+		)
+		select {
+		case <-w.retire:
+			return Job[In, Out]{}, false
+		case job, ok = <-lanes[PriorityHigh]:
+		case job, ok = <-lanes[PriorityNormal]:
+		case job, ok = <-lanes[PriorityLow]:
+		}
+		if !ok {
+			// A lane was closed, the next round drops it
+			continue
+		}
+		p.dispatched(job.Priority)
+
+		return job, true
+	}
+}
+
+// dispatchOrder lists the lanes from the highest to the lowest priority,
+// except that the lanes skipped too many times (aging) come first
+func (p *WorkerPool[In, Out]) dispatchOrder() [numPriorities]Priority {
+	var order [numPriorities]Priority
+	n := 0
+
+	for prio := PriorityLow; prio <= PriorityHigh; prio++ {
+		if p.starved[prio].Load() >= int64(p.opts.aging) {
+			order[n] = prio
+			n++
+		}
+	}
+	for prio := PriorityHigh; prio >= PriorityLow; prio-- {
+		if p.starved[prio].Load() < int64(p.opts.aging) {
+			order[n] = prio
+			n++
+		}
+	}
+
+	return order
+}
+
+// dispatched records that a job left the given lane: the lane is no longer
+// starving and every non-empty lower lane ages by one
+func (p *WorkerPool[In, Out]) dispatched(prio Priority) {
+	p.starved[prio].Store(0)
+
+	for lower := PriorityLow; lower < prio; lower++ {
+		if len(p.lanes[lower])+int(p.waiting[lower].Load()) > 0 {
+			p.starved[lower].Add(1)
+		}
+	}
+}
+
+// pending returns the number of jobs queued or waiting to be queued across all lanes and shards
+func (p *WorkerPool[In, Out]) pending() int {
+	n := 0
+	for prio := range p.lanes {
+		n += len(p.lanes[prio]) + int(p.waiting[prio].Load())
+	}
+	for _, shard := range p.shards {
+		n += len(shard)
+	}
+
+	return n
+}
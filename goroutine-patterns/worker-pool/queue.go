@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+	"time"
+)
+
+// Queue records the jobs accepted by a WorkerPool until they are acknowledged.
+// The pool keeps dispatching the jobs through its in-memory lanes; the queue
+// only decides what survives a restart: every input pushed and not acknowledged
+// is handed back by Pending and replayed when the pool starts.
+type Queue[In any] interface {
+	// Push records an accepted input and returns its id
+	Push(input In) (uint64, error)
+	// Ack forgets the input once its job is settled
+	Ack(id uint64) error
+	// Pending returns the inputs left unacknowledged by a previous run, in push order
+	Pending() []QueuedInput[In]
+}
+
+// QueuedInput is an input recorded by a Queue
+type QueuedInput[In any] struct {
+	ID    uint64
+	Input In
+}
+
+// memoryQueue is the default Queue: the in-memory lanes are the only storage,
+// so nothing survives a restart
+type memoryQueue[In any] struct {
+	nextID atomic.Uint64
+}
+
+func (q *memoryQueue[In]) Push(In) (uint64, error)    { return q.nextID.Add(1), nil }
+func (q *memoryQueue[In]) Ack(uint64) error           { return nil }
+func (q *memoryQueue[In]) Pending() []QueuedInput[In] { return nil }
+
+// Codec serializes the inputs stored by a durable Queue
+type Codec[In any] interface {
+	Encode(In) ([]byte, error)
+	Decode([]byte) (In, error)
+}
+
+// JSONCodec is a Codec based on encoding/json
+type JSONCodec[In any] struct{}
+
+// Encode implements Codec
+func (JSONCodec[In]) Encode(input In) ([]byte, error) {
+	return json.Marshal(input)
+}
+
+// Decode implements Codec
+func (JSONCodec[In]) Decode(data []byte) (In, error) {
+	var input In
+	err := json.Unmarshal(data, &input)
+	return input, err
+}
+
+// ack settles a job in the queue. A failed ack only means that the job is
+// replayed on the next start: delivery is at-least-once.
+func (p *WorkerPool[In, Out]) ack(job Job[In, Out]) {
+	_ = p.queue.Ack(job.id)
+}
+
+// replay enqueues the inputs left pending by a previous run. Their results are
+// not awaited by anyone, so they are only processed for their side effects.
+func (p *WorkerPool[In, Out]) replay() {
+	for _, pending := range p.queue.Pending() {
+		job := Job[In, Out]{
+			Ctx:      context.Background(),
+			Input:    pending.Input,
+			Priority: PriorityNormal,
+			Result:   make(chan Result[Out], 1),
+			queuedAt: time.Now(),
+			id:       pending.ID,
+		}
+
+		p.mu.RLock()
+		err := p.enqueueBlocking(job)
+		p.mu.RUnlock()
+		if err != nil {
+			// The pool is closing: the remaining inputs stay pending for the next run
+			return
+		}
+
+		p.opts.observer.OnEnqueue(JobEvent{WorkerID: -1, Priority: job.Priority, Input: job.Input})
+	}
+}
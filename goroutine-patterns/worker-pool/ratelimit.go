@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket is a token bucket rate limiter: it refills at rate tokens per second
+// up to burst tokens, and every Wait consumes one token.
+// A rate of zero or less disables the limit.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket creates a full bucket allowing rate events per second with bursts of burst events
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	burst = max(burst, 1)
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// SetRate changes the rate and the burst of the bucket, the tokens already available are kept
+func (b *TokenBucket) SetRate(rate float64, burst int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	b.rate = rate
+	b.burst = float64(max(burst, 1))
+	b.tokens = math.Min(b.tokens, b.burst)
+}
+
+// Wait blocks until a token is available and consumes it, or returns the context error
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		delay, ok := b.take()
+		if ok {
+			return nil
+		}
+
+		// Sleep until the next token, then try again as the rate may have changed meanwhile
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// take consumes a token if one is available, or returns the time until the next one
+func (b *TokenBucket) take() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.rate <= 0 {
+		return 0, true
+	}
+
+	b.refill(time.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+
+	missing := 1 - b.tokens
+	return time.Duration(missing / b.rate * float64(time.Second)), false
+}
+
+// full reports whether the bucket is back to its burst, i.e. unused lately
+func (b *TokenBucket) full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refill(time.Now())
+	return b.tokens >= b.burst
+}
+
+// refill adds the tokens earned since the last refill. It must be called with b.mu held.
+func (b *TokenBucket) refill(now time.Time) {
+	if b.rate > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+// keyedLimiterSweep is the number of buckets above which idle buckets are dropped
+const keyedLimiterSweep = 1024
+
+// keyedLimiter holds one token bucket per key, created on first use
+type keyedLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*TokenBucket
+}
+
+// newKeyedLimiter creates a limiter allowing rate events per second and burst events per key
+func newKeyedLimiter(rate float64, burst int) *keyedLimiter {
+	return &keyedLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*TokenBucket),
+	}
+}
+
+// Wait blocks until a token is available for key
+func (l *keyedLimiter) Wait(ctx context.Context, key string) error {
+	return l.bucket(key).Wait(ctx)
+}
+
+// SetRate changes the rate and the burst of every key
+func (l *keyedLimiter) SetRate(rate float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate, l.burst = rate, burst
+	for _, b := range l.buckets {
+		b.SetRate(rate, burst)
+	}
+}
+
+// bucket returns the bucket of key, dropping the idle buckets when there are too many
+func (l *keyedLimiter) bucket(key string) *TokenBucket {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if b, ok := l.buckets[key]; ok {
+		return b
+	}
+
+	// A full bucket behaves exactly like a new one, so it can be forgotten
+	if len(l.buckets) >= keyedLimiterSweep {
+		for k, b := range l.buckets {
+			if b.full() {
+				delete(l.buckets, k)
+			}
+		}
+	}
+
+	b := NewTokenBucket(l.rate, l.burst)
+	l.buckets[key] = b
+
+	return b
+}
+
+// SetRateLimit changes the global rate limit of the pool at runtime.
+// A rate of zero or less removes the limit.
+func (p *WorkerPool[In, Out]) SetRateLimit(rate float64, burst int) {
+	p.limiter.SetRate(rate, burst)
+}
+
+// SetKeyRateLimit changes the per-key rate limit set by WithKeyRateLimit at runtime
+func (p *WorkerPool[In, Out]) SetKeyRateLimit(rate float64, burst int) error {
+	if p.keyLimiter == nil {
+		return ErrNoKeyRateLimit
+	}
+
+	p.keyLimiter.SetRate(rate, burst)
+	return nil
+}
+
+// wait blocks until the rate limits let the job through
+func (p *WorkerPool[In, Out]) wait(job Job[In, Out]) error {
+	if p.keyLimiter != nil {
+		if err := p.keyLimiter.Wait(job.Ctx, p.limitKeyOf(job.Input)); err != nil {
+			return err
+		}
+	}
+
+	return p.limiter.Wait(job.Ctx)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// worker is the handle kept by the pool on each worker goroutine
+type worker struct {
+	id     int
+	retire chan struct{} // closed by Resize to make the worker exit after its current job
+	shard  int           // shard served by the worker in keyed mode, -1 otherwise
+	busy   atomic.Bool
+
+	jobs     atomic.Uint64
+	busyTime atomic.Int64 // nanoseconds spent processing jobs
+}
+
+// Resize grows or shrinks the pool to n workers while it is running.
+// Shrinking retires idle workers first; a busy worker that has to go
+// finishes its current job before exiting. Before Start, Resize only
+// changes the number of workers that Start will launch.
+// A keyed pool cannot be resized, as moving keys across shards would break their order.
+func (p *WorkerPool[In, Out]) Resize(n int) error {
+	if n < 1 {
+		return ErrInvalidSize
+	}
+	if p.keyed() {
+		return ErrKeyedResize
+	}
+
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+	p.resize(n)
+
+	return nil
+}
+
+// Size returns the number of workers the pool is running, or will run once started
+func (p *WorkerPool[In, Out]) Size() int {
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	return p.size
+}
+
+// resize adjusts the worker set to n workers. It must be called with p.wmu held.
+func (p *WorkerPool[In, Out]) resize(n int) {
+	p.size = n
+	if !p.started {
+		return
+	}
+
+	for len(p.workers) < n {
+		p.spawn()
+	}
+
+	excess := len(p.workers) - n
+	if excess <= 0 {
+		return
+	}
+
+	// Retire the idle workers first, then the busy ones
+	idle := make([]*worker, 0, len(p.workers))
+	busy := make([]*worker, 0, len(p.workers))
+	for _, w := range p.workers {
+		if w.busy.Load() {
+			busy = append(busy, w)
+		} else {
+			idle = append(idle, w)
+		}
+	}
+
+	candidates := append(idle, busy...)
+	for _, w := range candidates[:excess] {
+		close(w.retire)
+	}
+	p.workers = candidates[excess:]
+}
+
+// AutoscaleConfig bounds the number of workers managed by the autoscaler
+type AutoscaleConfig struct {
+	// Min and Max are the bounds of the pool size
+	Min, Max int
+	// Interval is the period between two scaling decisions, one second by default
+	Interval time.Duration
+}
+
+// autoscale periodically resizes the pool from the queue depth and the job latency.
+// It grows the pool by the number of workers needed to absorb the backlog within
+// one interval, and shrinks it by half of the idle workers once the queue is empty.
+func (p *WorkerPool[In, Out]) autoscale(cfg AutoscaleConfig) {
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		}
+
+		depth := p.pending()
+		latency := p.latency.reset()
+
+		p.wmu.Lock()
+		if p.closed {
+			p.wmu.Unlock()
+			return
+		}
+
+		size := len(p.workers)
+		idle := 0
+		for _, w := range p.workers {
+			if !w.busy.Load() {
+				idle++
+			}
+		}
+
+		target := size
+		switch {
+		case depth > 0:
+			// Backlog drained by one worker per interval: interval / latency jobs
+			need := 1
+			if latency > 0 {
+				need = int(math.Ceil(float64(depth) * float64(latency) / float64(cfg.Interval)))
+			}
+			target = size + max(need, 1)
+		case idle > 0:
+			target = size - max(idle/2, 1)
+		}
+
+		target = min(max(target, cfg.Min), cfg.Max)
+		if target != size {
+			p.resize(target)
+		}
+		p.wmu.Unlock()
+	}
+}
+
+// latencyWindow accumulates job durations between two autoscaler ticks
+type latencyWindow struct {
+	mu    sync.Mutex
+	total time.Duration
+	count int
+}
+
+// observe records the duration of one job
+func (l *latencyWindow) observe(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.total += d
+	l.count++
+}
+
+// reset returns the mean duration since the previous reset and starts a new window
+func (l *latencyWindow) reset() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var mean time.Duration
+	if l.count > 0 {
+		mean = l.total / time.Duration(l.count)
+	}
+	l.total, l.count = 0, 0
+
+	return mean
+}
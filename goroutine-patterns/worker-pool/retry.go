@@ -0,0 +1,70 @@
+package main
+
+import (
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy describes how a failed job is retried by its worker
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, the first one included
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, MaxBackoff caps the delays
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Multiplier grows the delay after every retry, 2 by default
+	Multiplier float64
+	// Jitter randomizes each delay by up to this fraction of it, between 0 and 1
+	Jitter float64
+	// Retryable classifies the errors worth a retry, by default every error is.
+	// A job whose context is done, or cancelled by ShutdownNow, is never retried.
+	Retryable func(error) bool
+}
+
+// backoff returns the delay to wait after the given failed attempt, starting at 1
+func (r RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := r.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	delay := float64(r.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if r.MaxBackoff > 0 {
+		delay = math.Min(delay, float64(r.MaxBackoff))
+	}
+	if r.Jitter > 0 {
+		delay += delay * math.Min(r.Jitter, 1) * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(delay)
+}
+
+// retryable reports whether the failed attempt of job deserves another one. A job
+// given up by its submitter or by ShutdownNow is not retried, whatever its error:
+// an attempt cut by the job timeout of the pool is left to Retryable.
+func (p *WorkerPool[In, Out]) retryable(job Job[In, Out], err error) bool {
+	if job.Ctx.Err() != nil || p.ctx.Err() != nil {
+		return false
+	}
+	if p.opts.retry.Retryable != nil {
+		return p.opts.retry.Retryable(err)
+	}
+
+	return true
+}
+
+// sleep waits for the delay unless the job or the pool is cancelled first
+func (p *WorkerPool[In, Out]) sleep(job Job[In, Out], delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-job.Ctx.Done():
+		return false
+	case <-p.ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// timerEntry is a callback due at a given time
+type timerEntry struct {
+	at    time.Time
+	seq   uint64 // keeps the entries due at the same time in scheduling order
+	fire  func()
+	index int // position in the heap, -1 once removed
+}
+
+// timerHeap is a min-heap of entries ordered by due time
+type timerHeap []*timerEntry
+
+func (h timerHeap) Len() int { return len(h) }
+
+func (h timerHeap) Less(i, j int) bool {
+	if h[i].at.Equal(h[j].at) {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].at.Before(h[j].at)
+}
+
+func (h timerHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *timerHeap) Push(x any) {
+	e := x.(*timerEntry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *timerHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+// scheduler fires callbacks at their due time from a single goroutine and a
+// single timer, however many entries are scheduled
+type scheduler struct {
+	mu      sync.Mutex
+	entries timerHeap
+	seq     uint64
+	wake    chan struct{} // signals that the earliest entry may have changed
+	once    sync.Once
+}
+
+// newScheduler creates an idle scheduler
+func newScheduler() *scheduler {
+	return &scheduler{wake: make(chan struct{}, 1)}
+}
+
+// schedule registers fire to be called at the given time, starting the scheduler
+// goroutine on first use. fire runs on the scheduler goroutine and must not block.
+func (s *scheduler) schedule(at time.Time, fire func(), quit <-chan struct{}) *timerEntry {
+	s.once.Do(func() { go s.run(quit) })
+
+	s.mu.Lock()
+	s.seq++
+	e := &timerEntry{at: at, seq: s.seq, fire: fire}
+	heap.Push(&s.entries, e)
+	s.mu.Unlock()
+
+	s.notify()
+	return e
+}
+
+// cancel removes an entry that has not fired yet
+func (s *scheduler) cancel(e *timerEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e.index >= 0 {
+		heap.Remove(&s.entries, e.index)
+	}
+}
+
+// notify wakes the scheduler goroutine up without blocking
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// run fires the due entries until quit is closed
+func (s *scheduler) run(quit <-chan struct{}) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		var due []*timerEntry
+		for len(s.entries) > 0 && !s.entries[0].at.After(now) {
+			due = append(due, heap.Pop(&s.entries).(*timerEntry))
+		}
+		wait := time.Hour
+		if len(s.entries) > 0 {
+			wait = s.entries[0].at.Sub(now)
+		}
+		s.mu.Unlock()
+
+		for _, e := range due {
+			e.fire()
+		}
+
+		timer.Reset(wait)
+		select {
+		case <-timer.C:
+		case <-s.wake:
+		case <-quit:
+			return
+		}
+	}
+}
+
+// SubmitAt waits until the given time, then submits the input like Submit and
+// returns its result. The wait is served by the scheduler of the pool, a single
+// timer shared by every delayed job.
+func (p *WorkerPool[In, Out]) SubmitAt(ctx context.Context, input In, at time.Time) (Out, error) {
+	ready := make(chan struct{})
+	entry := p.scheduler.schedule(at, func() { close(ready) }, p.quit)
+
+	select {
+	case <-ready:
+		return p.Submit(ctx, input)
+	case <-ctx.Done():
+		p.scheduler.cancel(entry)
+		return *new(Out), ctx.Err()
+	case <-p.quit:
+		p.scheduler.cancel(entry)
+		return *new(Out), ErrPoolClosed
+	}
+}
+
+// SubmitAfter is like SubmitAt with a delay from now
+func (p *WorkerPool[In, Out]) SubmitAfter(ctx context.Context, input In, delay time.Duration) (Out, error) {
+	return p.SubmitAt(ctx, input, time.Now().Add(delay))
+}
+
+// Schedule submits the input at every activation of a cron expression, see parseCron
+// for the syntax, until the returned stop function is called or the pool shuts down.
+// An activation is skipped, and counted in Stats.Skipped, while the job of the previous
+// one is still queued or running, so that a busy pool never piles up activations.
+// The results are not returned: use an Observer, Stats or a dead letter sink to follow them.
+func (p *WorkerPool[In, Out]) Schedule(spec string, input In) (stop func(), err error) {
+	cron, err := parseCron(spec)
+	if err != nil {
+		return nil, err
+	}
+	if cron.next(time.Now()).IsZero() {
+		return nil, fmt.Errorf("workerpool: cron expression %q never fires", spec)
+	}
+
+	var (
+		mu      sync.Mutex
+		entry   *timerEntry
+		stopped bool
+		pending atomic.Bool // the job of the previous activation is not done yet
+	)
+
+	var arm func(after time.Time)
+	arm = func(after time.Time) {
+		next := cron.next(after)
+		if next.IsZero() {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if stopped {
+			return
+		}
+
+		entry = p.scheduler.schedule(next, func() {
+			if pending.CompareAndSwap(false, true) {
+				go func() {
+					defer pending.Store(false)
+					_, _ = p.Submit(context.Background(), input)
+				}()
+			} else {
+				p.stats.skipped.Add(1)
+			}
+			arm(next)
+		}, p.quit)
+	}
+	arm(time.Now())
+
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+
+		stopped = true
+		if entry != nil {
+			p.scheduler.cancel(entry)
+		}
+	}, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Observer is notified of the life cycle of every job.
+// Its methods are called synchronously from Submit and the workers, so they must be fast.
+type Observer interface {
+	// OnEnqueue is called when a job has been accepted in a lane. As the job may
+	// be picked up right away, it can be reported after the OnStart of the same job.
+	OnEnqueue(JobEvent)
+	// OnStart is called when a worker, or the caller under CallerRuns, starts
+	// an attempt of a job
+	OnStart(JobEvent)
+	// OnFinish is called when the processor returned, with Duration and Err set
+	OnFinish(JobEvent)
+}
+
+// JobEvent describes a job to an Observer
+type JobEvent struct {
+	// WorkerID is the worker running the job, -1 when the job runs in the caller
+	WorkerID int
+	Priority Priority
+	Input    any
+	// Waited is the time the job spent in the queue, set from OnStart
+	Waited time.Duration
+	// Attempt is the number of the attempt, starting at 1, see WithRetry
+	Attempt int
+	// Duration and Err are only set for OnFinish
+	Duration time.Duration
+	Err      error
+}
+
+// nopObserver is used when no observer is configured
+type nopObserver struct{}
+
+func (nopObserver) OnEnqueue(JobEvent) {}
+func (nopObserver) OnStart(JobEvent)   {}
+func (nopObserver) OnFinish(JobEvent)  {}
+
+// Stats is a snapshot of the activity of a WorkerPool
+type Stats struct {
+	// Queued is the number of jobs waiting in the lanes or blocked in Submit
+	Queued int
+	// Running is the number of jobs being processed
+	Running int
+	// Completed and Failed count the processed jobs by outcome, after retries
+	Completed uint64
+	Failed    uint64
+	// Retried counts the attempts made after a failure
+	Retried uint64
+	// Rejected counts the jobs refused by a full queue or a closed pool,
+	// evicted by DropOldest or discarded by ShutdownNow
+	Rejected uint64
+	// Cancelled counts the jobs whose context was done before a worker picked them up
+	Cancelled uint64
+	// Skipped counts the cron activations skipped because the job of the previous
+	// activation of the same Schedule was still pending
+	Skipped uint64
+	// Workers describes the running workers
+	Workers []WorkerStats
+	// Latency is the distribution of the processing time of the jobs
+	Latency Histogram
+}
+
+// WorkerStats describes the activity of a single worker
+type WorkerStats struct {
+	ID       int
+	Busy     bool
+	Jobs     uint64
+	BusyTime time.Duration
+}
+
+// LatencyBuckets are the upper bounds of the buckets of Stats.Latency
+var LatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// Histogram counts durations in buckets: Counts[i] is the number of durations
+// up to Bounds[i], and the last count holds the durations above every bound
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+}
+
+// Total returns the number of durations recorded in the histogram
+func (h Histogram) Total() uint64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	return total
+}
+
+// poolStats holds the counters behind Stats
+type poolStats struct {
+	running   atomic.Int64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	rejected  atomic.Uint64
+	cancelled atomic.Uint64
+	retried   atomic.Uint64
+	skipped   atomic.Uint64
+
+	mu      sync.Mutex
+	latency []uint64 // one count per bucket of LatencyBuckets, plus the overflow
+}
+
+// observe records the processing time of a job
+func (s *poolStats) observe(d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.latency == nil {
+		s.latency = make([]uint64, len(LatencyBuckets)+1)
+	}
+
+	i := 0
+	for i < len(LatencyBuckets) && d > LatencyBuckets[i] {
+		i++
+	}
+	s.latency[i]++
+}
+
+// histogram returns a copy of the latency histogram
+func (s *poolStats) histogram() Histogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make([]uint64, len(LatencyBuckets)+1)
+	copy(counts, s.latency)
+
+	return Histogram{Bounds: LatencyBuckets, Counts: counts}
+}
+
+// Stats returns a snapshot of the activity of the pool
+func (p *WorkerPool[In, Out]) Stats() Stats {
+	stats := Stats{
+		Queued:    p.pending(),
+		Running:   int(p.stats.running.Load()),
+		Completed: p.stats.completed.Load(),
+		Failed:    p.stats.failed.Load(),
+		Rejected:  p.stats.rejected.Load(),
+		Cancelled: p.stats.cancelled.Load(),
+		Retried:   p.stats.retried.Load(),
+		Skipped:   p.stats.skipped.Load(),
+		Latency:   p.stats.histogram(),
+	}
+
+	p.wmu.Lock()
+	defer p.wmu.Unlock()
+
+	for _, w := range p.workers {
+		stats.Workers = append(stats.Workers, WorkerStats{
+			ID:       w.id,
+			Busy:     w.busy.Load(),
+			Jobs:     w.jobs.Load(),
+			BusyTime: time.Duration(w.busyTime.Load()),
+		})
+	}
+
+	return stats
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// WAL record kinds
+const (
+	walPush byte = 'P'
+	walAck  byte = 'A'
+)
+
+// walHeaderSize is the size of kind, id and payload length
+const walHeaderSize = 1 + 8 + 4
+
+// walMaxPayload bounds the payload length read from a record, a larger one means a corrupted header
+const walMaxPayload = 64 << 20
+
+// walCompactSize is the log size above which the log is compacted, once most of it
+// is made of acknowledged records
+const walCompactSize = 1 << 20
+
+// errWALCorrupted reports a record whose checksum or length is wrong
+var errWALCorrupted = errors.New("workerpool: corrupted WAL record")
+
+// WALQueue is a durable Queue backed by an append-only write-ahead log.
+// Every push and ack is a record synced to disk before returning, made of
+// a kind, the job id, the payload length, the payload and a CRC32 of all of them.
+// A record torn by a crash at the end of the log is detected and dropped on open,
+// a corrupted record anywhere else makes the open fail (see OpenWALQueue).
+// The log is compacted down to the pending records once the acknowledged ones
+// take most of it, so that it stays bounded while jobs are still pending.
+type WALQueue[In any] struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	codec   Codec[In]
+	nextID  uint64
+	size    int64             // size of the log
+	live    int64             // size of the push records still pending in the log
+	pending map[uint64][]byte // payloads pushed and not acknowledged yet
+	replay  []QueuedInput[In] // inputs left pending by the previous run
+}
+
+// OpenWALQueue opens, or creates, the log at path. The inputs left pending by a
+// previous run are decoded with codec, JSONCodec when nil, and the log is compacted
+// so that it only holds them.
+// A last record failing its checksum may be a torn write as well as a corruption:
+// it is then moved to path.corrupt and cut from the log, which is left uncompacted.
+func OpenWALQueue[In any](path string, codec Codec[In]) (*WALQueue[In], error) {
+	if codec == nil {
+		codec = JSONCodec[In]{}
+	}
+
+	q := &WALQueue[In]{
+		path:    path,
+		codec:   codec,
+		nextID:  1,
+		pending: make(map[uint64][]byte),
+	}
+
+	payloads, tail, err := q.load()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range sortedIDs(payloads) {
+		input, err := codec.Decode(payloads[id])
+		if err != nil {
+			return nil, fmt.Errorf("workerpool: decode WAL record %d: %w", id, err)
+		}
+		q.replay = append(q.replay, QueuedInput[In]{ID: id, Input: input})
+	}
+
+	q.pending = payloads
+	if tail.ambiguous {
+		if err := q.setAside(tail.offset); err != nil {
+			return nil, err
+		}
+		return q, nil
+	}
+	if err := q.compact(); err != nil {
+		return nil, err
+	}
+
+	return q, nil
+}
+
+// walTail describes where the valid records of a log end
+type walTail struct {
+	offset    int64 // end of the last valid record
+	ambiguous bool  // the bytes after offset are a complete record failing its checksum
+}
+
+// load reads the log and returns the payloads of the unacknowledged pushes.
+// A record cut short is only tolerated at the end of the log, where it is the trace
+// of a write interrupted by a crash, and a record failing its checksum only when it is
+// the last one; any other bad record makes load fail rather than drop the records after it.
+func (q *WALQueue[In]) load() (map[uint64][]byte, walTail, error) {
+	payloads := make(map[uint64][]byte)
+
+	file, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return payloads, walTail{}, nil
+	}
+	if err != nil {
+		return nil, walTail{}, fmt.Errorf("workerpool: open WAL: %w", err)
+	}
+	defer file.Close()
+
+	r := bufio.NewReader(file)
+	var offset int64
+	for {
+		kind, id, payload, err := readWALRecord(r)
+		if errors.Is(err, io.EOF) {
+			return payloads, walTail{offset: offset}, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The record runs past the end of the log: a torn tail, unless its length
+			// is corrupted and complete records follow it
+			if found, err := walRecordAfter(file, offset); err != nil || found {
+				return nil, walTail{}, q.corrupted(offset, err)
+			}
+			return payloads, walTail{offset: offset}, nil
+		}
+		if errors.Is(err, errWALCorrupted) {
+			if _, peekErr := r.Peek(1); errors.Is(peekErr, io.EOF) {
+				return payloads, walTail{offset: offset, ambiguous: true}, nil
+			}
+			return nil, walTail{}, q.corrupted(offset, nil)
+		}
+		if err != nil {
+			return nil, walTail{}, fmt.Errorf("workerpool: read WAL: %w", err)
+		}
+		offset += walRecordSize(payload)
+
+		switch kind {
+		case walPush:
+			payloads[id] = payload
+		case walAck:
+			delete(payloads, id)
+		}
+		q.nextID = max(q.nextID, id+1)
+	}
+}
+
+// corrupted returns the error reporting a bad record at offset
+func (q *WALQueue[In]) corrupted(offset int64, err error) error {
+	if err != nil {
+		return fmt.Errorf("workerpool: read WAL: %w", err)
+	}
+	return fmt.Errorf("%w at offset %d of %s", errWALCorrupted, offset, q.path)
+}
+
+// setAside moves the bytes of the log after offset to path.corrupt, then reopens the
+// log cut at offset for appending. It must be called before the queue is shared.
+func (q *WALQueue[In]) setAside(offset int64) error {
+	data, err := os.ReadFile(q.path)
+	if err != nil {
+		return fmt.Errorf("workerpool: open WAL: %w", err)
+	}
+	if err := os.WriteFile(q.path+".corrupt", data[offset:], 0o644); err != nil {
+		return fmt.Errorf("workerpool: set aside WAL tail: %w", err)
+	}
+
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("workerpool: open WAL: %w", err)
+	}
+	if err := errors.Join(q.file.Truncate(offset), q.file.Sync()); err != nil {
+		q.file.Close()
+		q.file = nil
+		return fmt.Errorf("workerpool: set aside WAL tail: %w", err)
+	}
+
+	q.size = offset
+	for _, payload := range q.pending {
+		q.live += walRecordSize(payload)
+	}
+
+	return nil
+}
+
+// compact rewrites the log with the pending pushes only, then reopens it for appending.
+// It must be called with q.mu held, or before the queue is shared.
+func (q *WALQueue[In]) compact() error {
+	tmp := q.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("workerpool: compact WAL: %w", err)
+	}
+
+	w := bufio.NewWriter(file)
+	var size int64
+	for _, id := range sortedIDs(q.pending) {
+		n, err := w.Write(encodeWALRecord(walPush, id, q.pending[id]))
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("workerpool: compact WAL: %w", err)
+		}
+		size += int64(n)
+	}
+
+	if err := errors.Join(w.Flush(), file.Sync(), file.Close()); err != nil {
+		return fmt.Errorf("workerpool: compact WAL: %w", err)
+	}
+
+	// The current log is closed before being replaced, which some platforms require
+	if q.file != nil {
+		if err := q.file.Close(); err != nil {
+			return fmt.Errorf("workerpool: compact WAL: %w", err)
+		}
+		q.file = nil
+	}
+	renameErr := os.Rename(tmp, q.path)
+
+	// Without the rename, the current log is still valid and appending goes on
+	q.file, err = os.OpenFile(q.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("workerpool: open WAL: %w", err)
+	}
+	if renameErr != nil {
+		return fmt.Errorf("workerpool: compact WAL: %w", renameErr)
+	}
+	q.size, q.live = size, size
+
+	return nil
+}
+
+// Push implements Queue
+func (q *WALQueue[In]) Push(input In) (uint64, error) {
+	payload, err := q.codec.Encode(input)
+	if err != nil {
+		return 0, fmt.Errorf("workerpool: encode WAL record: %w", err)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	id := q.nextID
+	if err := q.append(walPush, id, payload); err != nil {
+		return 0, err
+	}
+	q.nextID++
+	q.pending[id] = payload
+	q.live += walRecordSize(payload)
+
+	return id, nil
+}
+
+// Ack implements Queue
+func (q *WALQueue[In]) Ack(id uint64) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	payload, ok := q.pending[id]
+	if !ok {
+		return nil
+	}
+	if err := q.append(walAck, id, nil); err != nil {
+		return err
+	}
+	delete(q.pending, id)
+	q.live -= walRecordSize(payload)
+
+	// Rewrite the pending records once the acknowledged ones take most of the log,
+	// so that a job left pending, like a failed job, does not pin the whole log
+	if q.size > walCompactSize && q.size-q.live > q.live {
+		return q.compact()
+	}
+
+	return nil
+}
+
+// Pending implements Queue, it returns the inputs of the previous run not acknowledged yet
+func (q *WALQueue[In]) Pending() []QueuedInput[In] {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := make([]QueuedInput[In], 0, len(q.replay))
+	for _, input := range q.replay {
+		if _, ok := q.pending[input.ID]; ok {
+			pending = append(pending, input)
+		}
+	}
+
+	return pending
+}
+
+// Close closes the log file
+func (q *WALQueue[In]) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.file == nil {
+		return nil
+	}
+	return q.file.Close()
+}
+
+// append writes and syncs a record. It must be called with q.mu held.
+func (q *WALQueue[In]) append(kind byte, id uint64, payload []byte) error {
+	if q.file == nil {
+		return errors.New("workerpool: WAL is not open")
+	}
+
+	record := encodeWALRecord(kind, id, payload)
+	if _, err := q.file.Write(record); err != nil {
+		return fmt.Errorf("workerpool: write WAL: %w", err)
+	}
+	if err := q.file.Sync(); err != nil {
+		return fmt.Errorf("workerpool: sync WAL: %w", err)
+	}
+	q.size += int64(len(record))
+
+	return nil
+}
+
+// walRecordSize returns the size of a record with the given payload
+func walRecordSize(payload []byte) int64 {
+	return int64(walHeaderSize + len(payload) + 4)
+}
+
+// sortedIDs returns the ids of the payloads in increasing order, which is the push order
+func sortedIDs(payloads map[uint64][]byte) []uint64 {
+	ids := make([]uint64, 0, len(payloads))
+	for id := range payloads {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids
+}
+
+// walRecordAfter reports whether a complete record with a valid checksum starts
+// anywhere in the log after the start of the record at offset
+func walRecordAfter(file *os.File, offset int64) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() <= offset+1 {
+		return false, nil
+	}
+
+	rest := make([]byte, info.Size()-offset-1)
+	if _, err := file.ReadAt(rest, offset+1); err != nil && !errors.Is(err, io.EOF) {
+		return false, err
+	}
+
+	for i := range rest {
+		record := rest[i:]
+		if len(record) < walHeaderSize+4 || (record[0] != walPush && record[0] != walAck) {
+			continue
+		}
+		size := int64(binary.BigEndian.Uint32(record[9:13]))
+		if size > int64(len(record)-walHeaderSize-4) {
+			continue
+		}
+		end := walHeaderSize + size
+		if crc32.ChecksumIEEE(record[:end]) == binary.BigEndian.Uint32(record[end:end+4]) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// encodeWALRecord lays out a record as kind, id, payload length, payload and CRC32
+func encodeWALRecord(kind byte, id uint64, payload []byte) []byte {
+	record := make([]byte, walHeaderSize+len(payload)+4)
+	record[0] = kind
+	binary.BigEndian.PutUint64(record[1:9], id)
+	binary.BigEndian.PutUint32(record[9:13], uint32(len(payload)))
+	copy(record[walHeaderSize:], payload)
+
+	sum := crc32.ChecksumIEEE(record[:walHeaderSize+len(payload)])
+	binary.BigEndian.PutUint32(record[walHeaderSize+len(payload):], sum)
+
+	return record
+}
+
+// readWALRecord reads the next record, failing on a short read or a checksum mismatch
+func readWALRecord(r io.Reader) (kind byte, id uint64, payload []byte, err error) {
+	header := make([]byte, walHeaderSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+
+	size := binary.BigEndian.Uint32(header[9:13])
+	if size > walMaxPayload {
+		return 0, 0, nil, errWALCorrupted
+	}
+	body := make([]byte, int(size)+4)
+	if _, err = io.ReadFull(r, body); err != nil {
+		return 0, 0, nil, err
+	}
+
+	payload = body[:size]
+	sum := crc32.NewIEEE()
+	sum.Write(header)
+	sum.Write(payload)
+	if sum.Sum32() != binary.BigEndian.Uint32(body[size:]) {
+		return 0, 0, nil, errWALCorrupted
+	}
+
+	return header[0], binary.BigEndian.Uint64(header[1:9]), payload, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func openTestWAL(t *testing.T, path string) *WALQueue[string] {
+	t.Helper()
+
+	q, err := OpenWALQueue[string](path, nil)
+	if err != nil {
+		t.Fatalf("OpenWALQueue: %v", err)
+	}
+	t.Cleanup(func() { q.Close() })
+
+	return q
+}
+
+func pendingInputs(q *WALQueue[string]) []string {
+	var inputs []string
+	for _, p := range q.Pending() {
+		inputs = append(inputs, p.Input)
+	}
+	return inputs
+}
+
+func TestWALQueueReplaysPendingInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	for _, input := range []string{"a", "b", "c"} {
+		if _, err := q.Push(input); err != nil {
+			t.Fatalf("Push(%q): %v", input, err)
+		}
+	}
+	if err := q.Ack(2); err != nil {
+		t.Fatalf("Ack: %v", err)
+	}
+	q.Close()
+
+	q = openTestWAL(t, path)
+	if got, want := pendingInputs(q), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+
+	// Ids keep increasing across runs
+	id, err := q.Push("d")
+	if err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	if id != 4 {
+		t.Fatalf("Push() id = %d, want 4", id)
+	}
+}
+
+func TestWALQueueDropsTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	for _, input := range []string{"a", "b", "c"} {
+		if _, err := q.Push(input); err != nil {
+			t.Fatalf("Push(%q): %v", input, err)
+		}
+	}
+	q.Close()
+
+	// Cut the last record in the middle of its payload, as a crash during the write would
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Truncate(path, info.Size()-5); err != nil {
+		t.Fatal(err)
+	}
+
+	q = openTestWAL(t, path)
+	if got, want := pendingInputs(q), []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+}
+
+func TestWALQueueRejectsCorruptionBeforeTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	for _, input := range []string{"a", "b"} {
+		if _, err := q.Push(input); err != nil {
+			t.Fatalf("Push(%q): %v", input, err)
+		}
+	}
+	q.Close()
+
+	// Flip a payload byte of the first record
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[walHeaderSize] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenWALQueue[string](path, nil); !errors.Is(err, errWALCorrupted) {
+		t.Fatalf("OpenWALQueue() error = %v, want %v", err, errWALCorrupted)
+	}
+}
+
+func TestWALQueueCompactsWithPendingInputs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	if _, err := q.Push("failed"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	for i := 0; i < 30000; i++ {
+		id, err := q.Push("done")
+		if err != nil {
+			t.Fatalf("Push: %v", err)
+		}
+		if err := q.Ack(id); err != nil {
+			t.Fatalf("Ack: %v", err)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() > 2*walCompactSize {
+		t.Fatalf("log size = %d, want at most %d", info.Size(), 2*walCompactSize)
+	}
+	q.Close()
+
+	q = openTestWAL(t, path)
+	if got, want := pendingInputs(q), []string{"failed"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+}
+
+func TestWALQueueRejectsCorruptedLengthBeforeTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	for _, input := range []string{"a", "b", "c"} {
+		if _, err := q.Push(input); err != nil {
+			t.Fatalf("Push(%q): %v", input, err)
+		}
+	}
+	q.Close()
+
+	// Make the payload length of the first record run past the end of the log
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[9] = 0x01
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := OpenWALQueue[string](path, nil); !errors.Is(err, errWALCorrupted) {
+		t.Fatalf("OpenWALQueue() error = %v, want %v", err, errWALCorrupted)
+	}
+
+	// The log is left untouched for inspection
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(after, data) {
+		t.Fatal("the corrupted log was rewritten")
+	}
+}
+
+func TestWALQueueSetsAsideBadLastRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	q := openTestWAL(t, path)
+	for _, input := range []string{"a", "b"} {
+		if _, err := q.Push(input); err != nil {
+			t.Fatalf("Push(%q): %v", input, err)
+		}
+	}
+	q.Close()
+
+	// Flip the last byte of the checksum of the last record
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)-1] ^= 0xff
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	q = openTestWAL(t, path)
+	if got, want := pendingInputs(q), []string{"a"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+	aside, err := os.ReadFile(path + ".corrupt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := data[walRecordSize([]byte(`"a"`)):]; !reflect.DeepEqual(aside, want) {
+		t.Fatalf("set aside %q, want %q", aside, want)
+	}
+
+	// The log goes on after the records kept
+	if _, err := q.Push("c"); err != nil {
+		t.Fatalf("Push: %v", err)
+	}
+	q.Close()
+
+	q = openTestWAL(t, path)
+	if got, want := pendingInputs(q), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Pending() = %v, want %v", got, want)
+	}
+}
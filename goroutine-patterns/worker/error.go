@@ -0,0 +1,52 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrTaskDone is returned by a task to stop its worker normally.
+	// Only the RestartAlways policy restarts a worker after it.
+	ErrTaskDone = errors.New("worker: task done")
+
+	// ErrNotStarted is returned when pausing, resuming or triggering a worker that was not started
+	ErrNotStarted = errors.New("worker: not started")
+	// ErrWorkerPaused is returned when triggering a paused worker
+	ErrWorkerPaused = errors.New("worker: paused")
+	// ErrWorkerStopped is returned on any transition of a stopped worker
+	ErrWorkerStopped = errors.New("worker: stopped")
+	// ErrStopTimeout is returned when runs were still in progress after the stop timeout
+	ErrStopTimeout = errors.New("worker: stop timeout")
+
+	// ErrSupervisorStarted is returned when adding a child to a running supervisor
+	ErrSupervisorStarted = errors.New("supervisor: already started")
+	// ErrSupervisorStopped is returned when starting a stopped supervisor
+	ErrSupervisorStopped = errors.New("supervisor: stopped")
+	// ErrTooManyRestarts is returned when children failed more often than the restart intensity allows
+	ErrTooManyRestarts = errors.New("supervisor: too many restarts")
+	// ErrShutdownTimeout is returned for a child that did not exit before the shutdown deadline
+	ErrShutdownTimeout = errors.New("supervisor: shutdown timeout")
+)
+
+// PanicError is the failure recorded when the task panicked.
+// The panic is recovered so that the restart policy can deal with it.
+type PanicError struct {
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+// Error implements the error interface
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("worker: task panicked: %v", e.Value)
+}
+
+// Unwrap exposes the panic value when it is an error, so errors.Is/As keep working
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
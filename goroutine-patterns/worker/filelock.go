@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// fileLockRetry and fileLockWait bound how long a FileLocker waits for the guard
+// held by another replica, which only keeps it for a read and a write
+const (
+	fileLockRetry = 5 * time.Millisecond
+	fileLockWait  = 200 * time.Millisecond
+)
+
+// FileLocker is a Locker on a lease stored in a file, shared by the replicas
+// running on the same host or on a shared filesystem.
+// The file holds the owner and the expiry of the lease; its updates are serialized
+// by an advisory lock on a guard file next to it, which the system releases when
+// its holder dies, and written to a temporary file renamed over it, so that
+// a crash never leaves a partial lease.
+type FileLocker struct {
+	path  string
+	owner string
+}
+
+// NewFileLocker returns the Locker of owner on the lease stored at path
+func NewFileLocker(path, owner string) *FileLocker {
+	return &FileLocker{path: path, owner: owner}
+}
+
+// Acquire implements Locker
+func (f *FileLocker) Acquire(ctx context.Context, ttl time.Duration) (bool, error) {
+	return f.update(ctx, func(owner string, expires time.Time) (bool, bool) {
+		free := owner == f.owner || time.Now().After(expires)
+		return free, free
+	}, ttl)
+}
+
+// Renew implements Locker
+func (f *FileLocker) Renew(ctx context.Context, ttl time.Duration) (bool, error) {
+	return f.update(ctx, func(owner string, expires time.Time) (bool, bool) {
+		held := owner == f.owner && time.Now().Before(expires)
+		return held, held
+	}, ttl)
+}
+
+// Release implements Locker
+func (f *FileLocker) Release(ctx context.Context) error {
+	_, err := f.guarded(ctx, func() (bool, error) {
+		owner, _, err := f.read()
+		if err != nil || owner != f.owner {
+			return false, err
+		}
+		return true, os.Remove(f.path)
+	})
+
+	return err
+}
+
+// update reads the lease and, when decide allows it, writes it for this owner until now+ttl
+func (f *FileLocker) update(ctx context.Context, decide func(owner string, expires time.Time) (write, ok bool), ttl time.Duration) (bool, error) {
+	return f.guarded(ctx, func() (bool, error) {
+		owner, expires, err := f.read()
+		if err != nil {
+			return false, err
+		}
+
+		write, ok := decide(owner, expires)
+		if write {
+			lease := fmt.Sprintf("%s %d\n", f.owner, time.Now().Add(ttl).UnixNano())
+			if err := f.write([]byte(lease)); err != nil {
+				return false, err
+			}
+		}
+		return ok, nil
+	})
+}
+
+// write replaces the lease atomically: a reader sees either the old or the new lease
+func (f *FileLocker) write(lease []byte) error {
+	tmp := f.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(lease); err != nil {
+		file.Close()
+		return err
+	}
+	if err := errors.Join(file.Sync(), file.Close()); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, f.path)
+}
+
+// read returns the owner and the expiry of the lease, zero values if there is none.
+// A malformed lease, which only a crash or a foreign write can leave, counts as expired
+// so that the replicas do not stand by forever.
+func (f *FileLocker) read() (string, time.Time, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", time.Time{}, nil
+	}
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	owner, expires, found := strings.Cut(strings.TrimSpace(string(data)), " ")
+	nanos, err := strconv.ParseInt(expires, 10, 64)
+	if !found || err != nil {
+		return "", time.Time{}, nil
+	}
+
+	return owner, time.Unix(0, nanos), nil
+}
+
+// guarded runs fn while holding the lock of the guard file. The lock held by another
+// replica is waited for a short while, after which the lease counts as not available.
+// The guard file is never removed, so that every replica always locks the same file.
+func (f *FileLocker) guarded(ctx context.Context, fn func() (bool, error)) (bool, error) {
+	guard, err := os.OpenFile(f.path+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return false, err
+	}
+	defer guard.Close()
+
+	deadline := time.Now().Add(fileLockWait)
+	for {
+		locked, err := tryLock(guard)
+		if err != nil {
+			return false, err
+		}
+		if locked {
+			defer unlock(guard)
+			return fn()
+		}
+		if time.Now().After(deadline) {
+			return false, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(fileLockRetry):
+		}
+	}
+}
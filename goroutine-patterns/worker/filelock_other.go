@@ -0,0 +1,14 @@
+//go:build !unix
+
+package main
+
+import (
+	"errors"
+	"os"
+)
+
+// errNoFileLock reports a platform without the advisory locks FileLocker relies on
+var errNoFileLock = errors.New("worker: FileLocker needs advisory file locks, not available on this platform")
+
+func tryLock(*os.File) (bool, error) { return false, errNoFileLock }
+func unlock(*os.File) error          { return errNoFileLock }
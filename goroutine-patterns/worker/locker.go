@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Locker is a lease shared by the replicas of a Worker, so that only the holder runs the task.
+// Each replica has its own Locker, identified by its owner, on the same lease.
+type Locker interface {
+	// Acquire takes the lease for ttl if it is free, expired or already held by this owner.
+	// It returns false when another owner holds it.
+	Acquire(ctx context.Context, ttl time.Duration) (bool, error)
+	// Renew extends the lease held by this owner for ttl, and returns false if it was lost
+	Renew(ctx context.Context, ttl time.Duration) (bool, error)
+	// Release gives the lease up if it is held by this owner
+	Release(ctx context.Context) error
+}
+
+// MemoryLease is a lease shared in memory by the Lockers of a single process, for tests
+type MemoryLease struct {
+	mu      sync.Mutex
+	owner   string
+	expires time.Time
+}
+
+// Locker returns the Locker of owner on the lease
+func (l *MemoryLease) Locker(owner string) Locker {
+	return &memoryLocker{lease: l, owner: owner}
+}
+
+// Holder returns the owner of the lease, or "" if it is free or expired
+func (l *MemoryLease) Holder() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if time.Now().After(l.expires) {
+		return ""
+	}
+	return l.owner
+}
+
+// memoryLocker is the Locker of an owner on a MemoryLease
+type memoryLocker struct {
+	lease *MemoryLease
+	owner string
+}
+
+func (m *memoryLocker) Acquire(_ context.Context, ttl time.Duration) (bool, error) {
+	m.lease.mu.Lock()
+	defer m.lease.mu.Unlock()
+
+	now := time.Now()
+	if m.lease.owner != m.owner && now.Before(m.lease.expires) {
+		return false, nil
+	}
+	m.lease.owner, m.lease.expires = m.owner, now.Add(ttl)
+
+	return true, nil
+}
+
+func (m *memoryLocker) Renew(_ context.Context, ttl time.Duration) (bool, error) {
+	m.lease.mu.Lock()
+	defer m.lease.mu.Unlock()
+
+	now := time.Now()
+	if m.lease.owner != m.owner || now.After(m.lease.expires) {
+		return false, nil
+	}
+	m.lease.expires = now.Add(ttl)
+
+	return true, nil
+}
+
+func (m *memoryLocker) Release(context.Context) error {
+	m.lease.mu.Lock()
+	defer m.lease.mu.Unlock()
+
+	if m.lease.owner == m.owner {
+		m.lease.owner, m.lease.expires = "", time.Time{}
+	}
+
+	return nil
+}
+
+// elect consults the locker before a run, and reports whether this replica holds the lease
+func (w *Worker) elect(ctx context.Context) bool {
+	if w.opts.locker == nil {
+		return true
+	}
+
+	w.mu.Lock()
+	leader := w.health.Leader
+	w.mu.Unlock()
+
+	var (
+		ok  bool
+		err error
+	)
+	if leader {
+		ok, err = w.opts.locker.Renew(ctx, w.opts.lockTTL)
+	} else {
+		ok, err = w.opts.locker.Acquire(ctx, w.opts.lockTTL)
+	}
+	if err != nil {
+		// Without a reliable lease, standing by is the safe choice
+		log.Printf("Worker : lease unavailable: %v", err)
+		ok = false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if ok != w.health.Leader {
+		if ok {
+			log.Println("Worker : lease acquired, running")
+		} else {
+			log.Println("Worker : lease lost, standing by")
+		}
+	}
+	w.health.Leader = ok
+
+	return ok
+}
+
+// resign releases the lease when the worker exits, so that a standby replica takes over at once
+func (w *Worker) resign() {
+	w.mu.Lock()
+	leader := w.health.Leader
+	w.health.Leader = false
+	w.mu.Unlock()
+
+	if !leader {
+		return
+	}
+	if err := w.opts.locker.Release(context.Background()); err != nil {
+		log.Printf("Worker : lease not released: %v", err)
+	}
+}
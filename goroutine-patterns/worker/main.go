@@ -2,79 +2,152 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 )
 
-type Worker struct {
-	ctx    context.Context
-	cancel context.CancelFunc
-	done   chan struct{}
-}
-
-// NewWorker creates a new Worker with its own cancellable context
-func NewWorker(ctx context.Context) *Worker {
-	cctx, cancel := context.WithCancel(ctx)
-	return &Worker{
-		ctx:    cctx,
-		cancel: cancel,
-		done:   make(chan struct{}),
-	}
-}
-
-// Start begins the worker's execution in a separate goroutine
-func (w *Worker) Start() {
-	go func() {
-		defer close(w.done)
-
-		ticker := time.NewTicker(1 * time.Second)
-		defer ticker.Stop()
-
-		for {
-			select {
-			case <-w.ctx.Done():
-				// Handle cancellation
-				log.Println("Worker : shutting down signaled")
-				return
-			case <-ticker.C:
-				// Perform periodic work here
-				w.doWork()
-			}
-		}
-	}()
-}
-
-// Stop signals the worker to stop and waits for it to finish
-func (w *Worker) Stop() {
-	w.cancel()
-	<-w.done
-}
-
-// doWork represents the periodic work done by the worker
-func (w *Worker) doWork() {
+// doWork represents the periodic work done by the worker, failing from time to time
+func doWork(ctx context.Context) error {
 	log.Println("Worker : performing work")
 	// Simulate work by sleeping
 	time.Sleep(100 * time.Millisecond)
+
+	if time.Now().Second()%4 == 0 {
+		return errors.New("transient failure")
+	}
+	return nil
 }
 
 func main() {
 	// Create a root context
 	ctx := context.Background()
 
-	// Create and start the worker
-	worker := NewWorker(ctx)
+	// Create and start the worker: restarted after failures with an increasing delay
+	worker := NewWorker(ctx, doWork,
+		WithInterval(time.Second),
+		WithJitter(0.1),
+		WithErrorBackoff(4*time.Second),
+		WithRestart(RestartOnFailure, 5),
+	)
 
 	// Start the worker
 	worker.Start()
 
-	log.Println("Main : worker started, running for 5 seconds")
+	log.Println("Main : worker started, running for 3 seconds")
+
+	// Let the worker run for 3 seconds
+	time.Sleep(3 * time.Second)
 
-	// Let the worker run for 5 seconds
-	time.Sleep(5 * time.Second)
+	// Suspend the periodic runs, then ask for a run right after resuming
+	_ = worker.Pause()
+	if err := worker.TriggerNow(); errors.Is(err, ErrWorkerPaused) {
+		log.Printf("Main : trigger refused: %v", err)
+	}
+	log.Printf("Main : worker %s for 2 seconds", worker.State())
+	time.Sleep(2 * time.Second)
+	_ = worker.Resume()
+	_ = worker.TriggerNow()
+	time.Sleep(500 * time.Millisecond)
+
+	health := worker.Health()
+	log.Printf("Main : health: state=%s last run=%s last error=%v failures=%d restarts=%d",
+		health.State, health.LastRun.Format(time.TimeOnly), health.LastError,
+		health.ConsecutiveFailures, health.Restarts)
 
 	// Stop the worker gracefully
 	log.Println("Main : stopping worker....")
 	worker.Stop()
 
 	log.Println("Main : worker has been stopped")
+
+	overruns()
+	leaderElection()
+	supervision()
+}
+
+// leaderElection shows two replicas of the same job where only the lease holder runs it,
+// the standby replica taking over once the leader stops
+func leaderElection() {
+	var lease MemoryLease // NewFileLocker shares the lease between processes
+
+	replicas := make([]*Worker, 2)
+	for i, name := range []string{"replica-a", "replica-b"} {
+		replicas[i] = NewWorker(context.Background(), func(ctx context.Context) error {
+			log.Printf("%s : running the job", name)
+			return nil
+		}, WithInterval(200*time.Millisecond), WithLocker(lease.Locker(name), time.Second))
+		_ = replicas[i].Start()
+	}
+
+	time.Sleep(time.Second)
+	log.Printf("Main : %s holds the lease, stopping it", lease.Holder())
+	_ = replicas[0].Stop()
+
+	time.Sleep(time.Second)
+	log.Printf("Main : %s holds the lease", lease.Holder())
+	_ = replicas[1].Stop()
+}
+
+// overruns shows a worker whose runs last longer than its period
+func overruns() {
+	slow := NewWorker(context.Background(), func(ctx context.Context) error {
+		log.Println("Slow : export started")
+		select {
+		case <-time.After(700 * time.Millisecond): // Simulate a slow export
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		return nil
+	},
+		WithInterval(300*time.Millisecond),
+		// Up to 2 exports at the same time, each one bounded to 1 second
+		WithOverrun(OverrunConcurrent, 2),
+		WithRunTimeout(time.Second),
+		WithStopTimeout(500*time.Millisecond),
+	)
+
+	_ = slow.Start()
+	time.Sleep(2 * time.Second)
+
+	if err := slow.Stop(); err != nil {
+		log.Printf("Main : slow worker stopped with: %v", err)
+	}
+	log.Printf("Main : slow worker skipped %d runs", slow.Health().Skipped)
+}
+
+// supervision shows a supervisor restarting a failing worker and the workers started after it
+func supervision() {
+	sup := NewSupervisor(context.Background(), RestForOne, WithShutdownTimeout(2*time.Second))
+
+	_ = sup.Add("heartbeat", func(ctx context.Context) Child {
+		return NewWorker(ctx, func(ctx context.Context) error {
+			log.Println("Heartbeat : alive")
+			return nil
+		}, WithInterval(500*time.Millisecond))
+	})
+	_ = sup.Add("poller", func(ctx context.Context) Child {
+		// Without a restart policy of its own, the worker exits at the first failure
+		// and the supervisor restarts it
+		return NewWorker(ctx, doWork, WithInterval(300*time.Millisecond))
+	})
+	_ = sup.Add("reporters", func(ctx context.Context) Child {
+		nested := NewSupervisor(ctx, OneForOne)
+		_ = nested.Add("report", func(ctx context.Context) Child {
+			return NewWorker(ctx, func(ctx context.Context) error {
+				log.Println("Reporter : reporting")
+				return nil
+			}, WithInterval(time.Second))
+		})
+		return nested
+	})
+
+	sup.Start()
+	time.Sleep(3 * time.Second)
+
+	// Children are stopped in reverse order: reporters, poller, then heartbeat
+	if err := sup.Stop(); err != nil {
+		log.Printf("Main : supervisor stopped with: %v", err)
+	}
+	log.Println("Main : supervisor has been stopped")
 }
@@ -0,0 +1,153 @@
+package main
+
+import "time"
+
+// RestartPolicy decides whether a worker is restarted once its task stopped it
+type RestartPolicy int
+
+const (
+	// RestartNever stops the worker at the first failure or at ErrTaskDone
+	RestartNever RestartPolicy = iota
+	// RestartOnFailure restarts the worker after a failure, and stops it at ErrTaskDone
+	RestartOnFailure
+	// RestartAlways restarts the worker after a failure and after ErrTaskDone
+	RestartAlways
+)
+
+// String returns the name of the policy
+func (r RestartPolicy) String() string {
+	switch r {
+	case RestartNever:
+		return "never"
+	case RestartOnFailure:
+		return "on-failure"
+	case RestartAlways:
+		return "always"
+	default:
+		return "unknown"
+	}
+}
+
+// OverrunPolicy decides what happens to a run due while the previous runs are still in progress
+type OverrunPolicy int
+
+const (
+	// OverrunSkip drops the run
+	OverrunSkip OverrunPolicy = iota
+	// OverrunQueue keeps one run pending, started as soon as the current one completes
+	OverrunQueue
+	// OverrunConcurrent starts the run alongside the current ones up to a maximum, and drops it beyond
+	OverrunConcurrent
+)
+
+// String returns the name of the policy
+func (o OverrunPolicy) String() string {
+	switch o {
+	case OverrunSkip:
+		return "skip"
+	case OverrunQueue:
+		return "queue"
+	case OverrunConcurrent:
+		return "concurrent"
+	default:
+		return "unknown"
+	}
+}
+
+// options holds the optional settings of a Worker
+type options struct {
+	interval    time.Duration
+	jitter      float64
+	maxBackoff  time.Duration
+	restart     RestartPolicy
+	maxRestarts int
+
+	overrun       OverrunPolicy
+	maxConcurrent int
+	runTimeout    time.Duration
+	stopTimeout   time.Duration
+
+	locker  Locker
+	lockTTL time.Duration
+}
+
+// Option configures a Worker created by NewWorker
+type Option func(*options)
+
+// defaultOptions keeps the historical behaviour: a run every second, skipped while
+// the previous one is in progress, stopped by the first failure
+func defaultOptions() options {
+	return options{
+		interval: time.Second,
+		restart:  RestartNever,
+		overrun:  OverrunSkip,
+	}
+}
+
+// WithInterval sets the period between two runs of the task
+func WithInterval(interval time.Duration) Option {
+	return func(o *options) {
+		if interval > 0 {
+			o.interval = interval
+		}
+	}
+}
+
+// WithJitter randomizes every period by up to this fraction of it, between 0 and 1,
+// so that workers started together do not run in lockstep
+func WithJitter(fraction float64) Option {
+	return func(o *options) {
+		o.jitter = min(max(fraction, 0), 1)
+	}
+}
+
+// WithErrorBackoff doubles the delay before a restart for every consecutive
+// failure, starting from the interval, up to max
+func WithErrorBackoff(max time.Duration) Option {
+	return func(o *options) {
+		o.maxBackoff = max
+	}
+}
+
+// WithRestart sets the restart policy and the maximum number of restarts,
+// 0 meaning no limit
+func WithRestart(policy RestartPolicy, maxRestarts int) Option {
+	return func(o *options) {
+		o.restart = policy
+		o.maxRestarts = max(maxRestarts, 0)
+	}
+}
+
+// WithOverrun sets the overrun policy. maxConcurrent is the maximum number of runs
+// in progress at the same time with OverrunConcurrent, and is ignored otherwise.
+func WithOverrun(policy OverrunPolicy, maxConcurrent int) Option {
+	return func(o *options) {
+		o.overrun = policy
+		o.maxConcurrent = max(maxConcurrent, 1)
+	}
+}
+
+// WithRunTimeout bounds every run: the context given to the task is cancelled after timeout
+func WithRunTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.runTimeout = max(timeout, 0)
+	}
+}
+
+// WithStopTimeout bounds how long stopping or restarting the worker waits for the runs
+// in progress. A run still in progress after timeout is abandoned in the background.
+func WithStopTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.stopTimeout = max(timeout, 0)
+	}
+}
+
+// WithLocker makes the worker run its task only while it holds the lease of locker,
+// acquired or renewed for ttl before each run. ttl should be longer than the interval,
+// so that the holder keeps the lease between two runs.
+func WithLocker(locker Locker, ttl time.Duration) Option {
+	return func(o *options) {
+		o.locker = locker
+		o.lockTTL = ttl
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+// State is a step of the lifecycle of a Worker:
+// Idle -> Running <-> Paused -> Stopped
+type State int
+
+const (
+	// StateIdle is a worker created but not started yet
+	StateIdle State = iota
+	// StateRunning is a worker running its task at every period
+	StateRunning
+	// StatePaused is a started worker that skips its runs until resumed
+	StatePaused
+	// StateStopped is a worker stopped for good, by Stop or by its restart policy
+	StateStopped
+)
+
+// String returns the name of the state
+func (s State) String() string {
+	switch s {
+	case StateIdle:
+		return "idle"
+	case StateRunning:
+		return "running"
+	case StatePaused:
+		return "paused"
+	case StateStopped:
+		return "stopped"
+	default:
+		return "unknown"
+	}
+}
+
+// State returns the current state of the worker
+func (w *Worker) State() State {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.state
+}
+
+// Start begins the worker's execution in a separate goroutine.
+// Starting a started worker does nothing, a stopped worker cannot be started again.
+func (w *Worker) Start() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	switch w.state {
+	case StateIdle:
+		w.state = StateRunning
+		go w.work()
+		return nil
+	case StateStopped:
+		return ErrWorkerStopped
+	default:
+		return nil
+	}
+}
+
+// Pause suspends the runs of the task until Resume. A run in progress completes.
+func (w *Worker) Pause() error {
+	return w.transition(StateRunning, StatePaused)
+}
+
+// Resume restarts the runs of a paused worker, the next one after a full period
+func (w *Worker) Resume() error {
+	return w.transition(StatePaused, StateRunning)
+}
+
+// TriggerNow runs the task as soon as possible without waiting for the period.
+// While runs are in progress the trigger is handled by the overrun policy, like a tick.
+func (w *Worker) TriggerNow() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.check(StateRunning); err != nil {
+		return err
+	}
+	notify(w.trigger)
+
+	return nil
+}
+
+// Stop signals the worker to stop and waits for it to finish, at most the stop
+// timeout for the runs in progress. It returns the error the worker exited with,
+// see Err. Stopping a stopped worker does nothing.
+func (w *Worker) Stop() error {
+	w.mu.Lock()
+	if w.state == StateIdle {
+		// Never started: there is no goroutine to wait for
+		close(w.done)
+	}
+	w.state = StateStopped
+	w.mu.Unlock()
+
+	w.cancel()
+	<-w.done
+
+	return w.Err()
+}
+
+// transition moves the worker from one state to the other, and does nothing
+// when it is already in the target state
+func (w *Worker) transition(from, to State) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.state == to {
+		return nil
+	}
+	if err := w.check(from); err != nil {
+		return err
+	}
+	w.state = to
+	notify(w.changed)
+
+	return nil
+}
+
+// check returns the error explaining why the worker is not in the expected state
+func (w *Worker) check(expected State) error {
+	if w.state == expected {
+		return nil
+	}
+
+	switch w.state {
+	case StateIdle:
+		return ErrNotStarted
+	case StatePaused:
+		return ErrWorkerPaused
+	case StateStopped:
+		return ErrWorkerStopped
+	}
+
+	return nil
+}
+
+// exited records that the worker goroutine has returned
+func (w *Worker) exited() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.state = StateStopped
+}
+
+// notify sends a signal on a channel of capacity 1 without blocking, merging it with a pending one
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
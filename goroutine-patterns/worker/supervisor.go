@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Child is a process owned by a Supervisor, such as a Worker or a nested Supervisor.
+// It is stopped by cancelling the context it was created with.
+type Child interface {
+	// Start launches the child in its own goroutine
+	Start() error
+	// Done is closed once the child has exited
+	Done() <-chan struct{}
+	// Err is the reason of the exit, nil for a normal exit
+	Err() error
+}
+
+// Strategy decides which children are restarted when one of them fails
+type Strategy int
+
+const (
+	// OneForOne restarts only the failed child
+	OneForOne Strategy = iota
+	// OneForAll stops every other child and restarts them all
+	OneForAll
+	// RestForOne stops and restarts the failed child and the children started after it
+	RestForOne
+)
+
+// String returns the name of the strategy
+func (s Strategy) String() string {
+	switch s {
+	case OneForOne:
+		return "one-for-one"
+	case OneForAll:
+		return "one-for-all"
+	case RestForOne:
+		return "rest-for-one"
+	default:
+		return "unknown"
+	}
+}
+
+// supervisorOptions holds the optional settings of a Supervisor
+type supervisorOptions struct {
+	shutdownTimeout time.Duration
+	maxRestarts     int
+	restartPeriod   time.Duration
+}
+
+// SupervisorOption configures a Supervisor created by NewSupervisor
+type SupervisorOption func(*supervisorOptions)
+
+// WithShutdownTimeout bounds how long stopping the children may take
+func WithShutdownTimeout(timeout time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		if timeout > 0 {
+			o.shutdownTimeout = timeout
+		}
+	}
+}
+
+// WithRestartIntensity lets the children be restarted at most maxRestarts times
+// within period, after which the supervisor gives up and fails itself
+func WithRestartIntensity(maxRestarts int, period time.Duration) SupervisorOption {
+	return func(o *supervisorOptions) {
+		o.maxRestarts = max(maxRestarts, 0)
+		o.restartPeriod = period
+	}
+}
+
+// child is the supervisor's view of one of its children
+type child struct {
+	name   string
+	start  func(context.Context) Child
+	proc   Child
+	cancel context.CancelFunc
+	// gen identifies the current incarnation, so that the exit of a child
+	// stopped on purpose is not taken for a failure
+	gen int
+}
+
+// exit reports that an incarnation of a child has exited, or failed to start
+type exit struct {
+	index int
+	gen   int
+	err   error
+}
+
+type Supervisor struct {
+	ctx      context.Context
+	cancel   context.CancelFunc
+	done     chan struct{}
+	exits    chan exit
+	strategy Strategy
+	opts     supervisorOptions
+
+	mu       sync.Mutex
+	started  bool
+	stopped  bool
+	children []*child
+	restarts []time.Time
+	err      error
+}
+
+// NewSupervisor creates a new Supervisor applying strategy to its children
+func NewSupervisor(ctx context.Context, strategy Strategy, opts ...SupervisorOption) *Supervisor {
+	o := supervisorOptions{
+		shutdownTimeout: 5 * time.Second,
+		maxRestarts:     3,
+		restartPeriod:   5 * time.Second,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	return &Supervisor{
+		ctx:      cctx,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+		exits:    make(chan exit),
+		strategy: strategy,
+		opts:     o,
+	}
+}
+
+// Add registers a child, started in the order of registration. start is called
+// with the child's own context at every (re)start and returns a new child,
+// for example a Worker or a nested Supervisor created with that context.
+func (s *Supervisor) Add(name string, start func(context.Context) Child) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.stopped {
+		return ErrSupervisorStarted
+	}
+	s.children = append(s.children, &child{name: name, start: start})
+
+	return nil
+}
+
+// Start starts the children in order and supervises them in a separate goroutine.
+// Starting a started supervisor does nothing, a stopped supervisor cannot be started again.
+func (s *Supervisor) Start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return ErrSupervisorStopped
+	}
+	if !s.started {
+		s.started = true
+		go s.run()
+	}
+
+	return nil
+}
+
+// Stop stops the children in reverse order and waits for the supervisor to exit.
+// The error joins the children that did not exit before the shutdown deadline
+// and the failures of the children, if any.
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	if !s.started && !s.stopped {
+		// Never started: there is no goroutine to wait for
+		close(s.done)
+	}
+	s.stopped = true
+	s.mu.Unlock()
+
+	s.cancel()
+	<-s.done
+
+	return s.Err()
+}
+
+// Done returns a channel closed once the supervisor has exited
+func (s *Supervisor) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns the aggregated error of the supervisor, meaningful once Done is closed
+func (s *Supervisor) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// run supervises the children until the supervisor is stopped or gives up
+func (s *Supervisor) run() {
+	defer close(s.done)
+
+	var errs []error
+	defer func() {
+		s.mu.Lock()
+		s.err = errors.Join(errs...)
+		s.mu.Unlock()
+	}()
+
+	s.startChildren(0)
+
+	for {
+		select {
+		case <-s.ctx.Done():
+			errs = append(errs, s.stopChildren(0))
+			return
+		case e := <-s.exits:
+			c := s.children[e.index]
+			if e.gen != c.gen || c.proc == nil {
+				// A child stopped on purpose
+				continue
+			}
+
+			err := e.err
+			if err == nil {
+				err = c.proc.Err()
+			}
+			c.cancel()
+			c.proc, c.cancel = nil, nil
+			if err == nil {
+				log.Printf("Supervisor : child %q exited", c.name)
+				continue
+			}
+
+			log.Printf("Supervisor : child %q failed: %v", c.name, err)
+			if !s.allowRestart() {
+				errs = append(errs, fmt.Errorf("%w: child %q: %w", ErrTooManyRestarts, c.name, err), s.stopChildren(0))
+				return
+			}
+
+			switch s.strategy {
+			case OneForAll:
+				errs = append(errs, s.stopChildren(0))
+				s.startChildren(0)
+			case RestForOne:
+				errs = append(errs, s.stopChildren(e.index+1))
+				s.startChildren(e.index)
+			default:
+				s.startChild(e.index)
+			}
+		}
+	}
+}
+
+// startChildren starts the stopped children from index from, in order
+func (s *Supervisor) startChildren(from int) {
+	for i := from; i < len(s.children); i++ {
+		if s.children[i].proc == nil {
+			s.startChild(i)
+		}
+	}
+}
+
+// startChild starts a new incarnation of a child and watches for its exit
+func (s *Supervisor) startChild(index int) {
+	c := s.children[index]
+
+	// The child is only cancelled by the supervisor, so that it can stop the
+	// children one by one in reverse order
+	ctx, cancel := context.WithCancel(context.WithoutCancel(s.ctx))
+	c.gen++
+	c.proc, c.cancel = c.start(ctx), cancel
+
+	// A child that does not start is handled as a child that failed
+	err := c.proc.Start()
+	go func(proc Child, e exit) {
+		if e.err == nil {
+			<-proc.Done()
+		}
+		select {
+		case s.exits <- e:
+		case <-s.done:
+		}
+	}(c.proc, exit{index: index, gen: c.gen, err: err})
+}
+
+// stopChildren stops the running children from index from, in reverse order,
+// within the shutdown timeout. A child that does not exit in time is abandoned.
+func (s *Supervisor) stopChildren(from int) error {
+	deadline := time.NewTimer(s.opts.shutdownTimeout)
+	defer deadline.Stop()
+
+	var errs []error
+	expired := false
+	for i := len(s.children) - 1; i >= from; i-- {
+		c := s.children[i]
+		if c.proc == nil {
+			continue
+		}
+
+		proc := c.proc
+		c.cancel()
+		c.proc, c.cancel = nil, nil
+
+		if !expired {
+			select {
+			case <-proc.Done():
+			case <-deadline.C:
+				expired = true
+			}
+		}
+		select {
+		case <-proc.Done():
+			if err := proc.Err(); err != nil {
+				errs = append(errs, fmt.Errorf("child %q: %w", c.name, err))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%w: child %q did not exit within %s", ErrShutdownTimeout, c.name, s.opts.shutdownTimeout))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// allowRestart records a restart and reports whether it stays within the restart intensity
+func (s *Supervisor) allowRestart() bool {
+	now := time.Now()
+	recent := s.restarts[:0]
+	for _, t := range s.restarts {
+		if now.Sub(t) < s.opts.restartPeriod {
+			recent = append(recent, t)
+		}
+	}
+	s.restarts = append(recent, now)
+
+	return len(s.restarts) <= s.opts.maxRestarts
+}
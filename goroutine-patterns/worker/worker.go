@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Task is the periodic work of a Worker. Returning an error, or panicking,
+// is a failure handled by the restart policy; ErrTaskDone stops the worker normally.
+type Task func(context.Context) error
+
+// Health is a snapshot of the state of a Worker
+type Health struct {
+	State               State
+	LastRun             time.Time
+	LastError           error
+	ConsecutiveFailures int
+	Restarts            int
+	// Skipped counts the runs dropped by the overrun policy
+	Skipped int
+	// Leader reports whether the worker holds the lease of its Locker
+	Leader bool
+}
+
+type Worker struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+	task   Task
+	opts   options
+
+	// trigger asks for an immediate run, changed wakes the loop up on pause and resume
+	trigger chan struct{}
+	changed chan struct{}
+
+	mu     sync.Mutex
+	state  State
+	health Health
+	err    error
+}
+
+// NewWorker creates a new Worker running task periodically with its own cancellable context
+func NewWorker(ctx context.Context, task Task, opts ...Option) *Worker {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	return &Worker{
+		ctx:     cctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		task:    task,
+		opts:    o,
+		trigger: make(chan struct{}, 1),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// work runs the task loop and restarts it according to the restart policy
+func (w *Worker) work() {
+	defer close(w.done)
+	defer w.exited()
+	defer w.resign()
+
+	for {
+		err := w.loop()
+		if w.ctx.Err() != nil {
+			// Handle cancellation
+			log.Println("Worker : shutting down signaled")
+			if errors.Is(err, ErrStopTimeout) {
+				w.setErr(err)
+			}
+			return
+		}
+
+		if !w.shouldRestart(err) {
+			log.Printf("Worker : stopped: %v", err)
+			if !errors.Is(err, ErrTaskDone) {
+				w.setErr(err)
+			}
+			return
+		}
+
+		// Wait before restarting, longer after each consecutive failure
+		log.Printf("Worker : restarting after: %v", err)
+		if !w.sleep(w.backoff()) {
+			return
+		}
+	}
+}
+
+// Done returns a channel closed once the worker has exited
+func (w *Worker) Done() <-chan struct{} {
+	return w.done
+}
+
+// Err returns the failure that made the worker give up, or the runs abandoned
+// by the stop timeout, and nil if it was stopped or its task finished normally.
+// It is meaningful once Done is closed.
+func (w *Worker) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Health returns a snapshot of the state of the worker
+func (w *Worker) Health() Health {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	health := w.health
+	health.State = w.state
+
+	return health
+}
+
+// loop runs the task on a fixed schedule until it fails, asks to stop, or the worker
+// is cancelled. Every run has its own goroutine, so that a run due while the previous
+// ones are still in progress is handled by the overrun policy.
+func (w *Worker) loop() error {
+	ctx, cancel := context.WithCancel(w.ctx)
+	defer cancel()
+
+	// The results channel can hold every run, so that an abandoned run never blocks
+	limit := w.concurrency()
+	results := make(chan error, limit)
+	// A restarted loop keeps the pause requested during the previous one, whose
+	// change signal is already consumed
+	running, queued, paused := 0, false, w.State() == StatePaused
+
+	start := func() {
+		running++
+		go func() {
+			// Perform periodic work here
+			results <- w.run(ctx)
+		}()
+	}
+	dispatch := func() {
+		switch {
+		case running < limit:
+			start()
+		case w.opts.overrun == OverrunQueue && !queued:
+			queued = true
+		default:
+			w.skipped()
+		}
+	}
+	resume := func() {
+		if queued && !paused && running < limit {
+			queued = false
+			start()
+		}
+	}
+
+	timer := time.NewTimer(w.period())
+	defer timer.Stop()
+
+	for {
+		// While the worker is paused the period is suspended, and starts over on resume
+		var tick <-chan time.Time
+		if !paused {
+			tick = timer.C
+		}
+
+		select {
+		case <-ctx.Done():
+			if err := w.drain(results, running); err != nil {
+				return err
+			}
+			return ctx.Err()
+		case <-w.changed:
+			if p := w.State() == StatePaused; p != paused {
+				paused = p
+				if !paused {
+					timer.Reset(w.period())
+					resume()
+				}
+			}
+		case <-w.trigger:
+			dispatch()
+		case <-tick:
+			// The next tick is due one period after this one, whatever the run duration
+			timer.Reset(w.period())
+			dispatch()
+		case err := <-results:
+			running--
+			if err != nil {
+				// Interrupt the other runs before the restart policy applies
+				cancel()
+				if stuck := w.drain(results, running); stuck != nil {
+					err = errors.Join(err, stuck)
+				}
+				return err
+			}
+			resume()
+		}
+	}
+}
+
+// run executes the task once with the run timeout, recovering a panic, and records
+// the outcome in the health. A run interrupted by the worker is not a failure,
+// and a replica that does not hold the lease stands by.
+func (w *Worker) run(ctx context.Context) (err error) {
+	if !w.elect(ctx) {
+		return nil
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		if ctx.Err() != nil {
+			err = nil
+			return
+		}
+		w.record(err)
+	}()
+
+	runCtx := ctx
+	if w.opts.runTimeout > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, w.opts.runTimeout)
+		defer cancel()
+	}
+
+	return w.task(runCtx)
+}
+
+// drain waits for the runs in progress, at most the stop timeout, after which
+// the remaining runs are abandoned and reported as an ErrStopTimeout
+func (w *Worker) drain(results <-chan error, running int) error {
+	var timeout <-chan time.Time
+	if w.opts.stopTimeout > 0 {
+		timer := time.NewTimer(w.opts.stopTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	for ; running > 0; running-- {
+		select {
+		case <-results:
+		case <-timeout:
+			return fmt.Errorf("%w: %d run(s) still in progress after %s", ErrStopTimeout, running, w.opts.stopTimeout)
+		}
+	}
+
+	return nil
+}
+
+// concurrency returns the maximum number of runs in progress at the same time
+func (w *Worker) concurrency() int {
+	if w.opts.overrun == OverrunConcurrent {
+		return w.opts.maxConcurrent
+	}
+
+	return 1
+}
+
+// skipped counts a run dropped by the overrun policy
+func (w *Worker) skipped() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.health.Skipped++
+}
+
+// record updates the health after a run
+func (w *Worker) record(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.health.LastRun = time.Now()
+	w.health.LastError = err
+	if err != nil && !errors.Is(err, ErrTaskDone) {
+		w.health.ConsecutiveFailures++
+	} else {
+		w.health.ConsecutiveFailures = 0
+	}
+}
+
+// shouldRestart applies the restart policy to the error that ended the loop,
+// and counts the restart
+func (w *Worker) shouldRestart(err error) bool {
+	switch w.opts.restart {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		if errors.Is(err, ErrTaskDone) {
+			return false
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.opts.maxRestarts > 0 && w.health.Restarts >= w.opts.maxRestarts {
+		return false
+	}
+	w.health.Restarts++
+
+	return true
+}
+
+// period returns the delay before the next run, randomized by the jitter
+func (w *Worker) period() time.Duration {
+	d := float64(w.opts.interval)
+	if w.opts.jitter > 0 {
+		d += d * w.opts.jitter * (2*rand.Float64() - 1)
+	}
+
+	return time.Duration(d)
+}
+
+// backoff returns the delay before a restart: the interval, doubled for every
+// consecutive failure beyond the first one when an error backoff is set
+func (w *Worker) backoff() time.Duration {
+	if w.opts.maxBackoff <= 0 {
+		return 0
+	}
+
+	w.mu.Lock()
+	failures := w.health.ConsecutiveFailures
+	w.mu.Unlock()
+
+	d := w.opts.interval
+	for i := 1; i < failures && d < w.opts.maxBackoff; i++ {
+		d *= 2
+	}
+
+	return min(d, w.opts.maxBackoff)
+}
+
+// sleep waits for the delay, returning false if the worker is cancelled meanwhile
+func (w *Worker) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-w.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// setErr records the failure that made the worker give up
+func (w *Worker) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.err = err
+}